@@ -2,18 +2,24 @@
 package handlers
 
 import (
+	"context"
 	"expvar"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 
 	"github.com/asishcse60/service/app/services/sales-api/handlers/debug/checkgrp"
 	v1 "github.com/asishcse60/service/app/services/sales-api/handlers/v1"
+	"github.com/asishcse60/service/app/services/sales-api/handlers/wellknown/keygrp"
 	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/oidc"
+	"github.com/asishcse60/service/business/sys/password"
 	"github.com/asishcse60/service/business/web/v1/mid"
+	"github.com/asishcse60/service/foundation/keystore"
 	"github.com/asishcse60/service/foundation/web"
 )
 
@@ -59,7 +65,41 @@ type APIMuxConfig struct {
 	Shutdown chan os.Signal
 	Log      *zap.SugaredLogger
 	Auth     *auth.Auth
+	Issuer   string
+	URL      string // URL clients reach the api at.
+	Keys     *keystore.KeyStore
+	Policy   *auth.Policy
+	Hasher   password.Hasher
 	DB       *sqlx.DB
+	OIDC     *oidc.Provider
+
+	// OIDCLanding is the page browsers are sent to once logged in through
+	// the OpenID Connect provider.
+	OIDCLanding string
+
+	// SessionGroups lists the v1 route groups that accept session cookies.
+	SessionGroups []string
+	SecureCookies bool
+
+	// MaxBodyBytes limits the size of request bodies for every route. Zero
+	// leaves them unbounded.
+	MaxBodyBytes int64
+
+	// RequestTimeout bounds how long a request can run unless its route
+	// sets another timeout. Zero leaves requests unbounded.
+	RequestTimeout time.Duration
+
+	// RateLimits describes how clients are told apart and where the buckets
+	// used to rate limit them are kept.
+	RateLimits mid.RateLimitConfig
+
+	// CORS describes the origins browsers can call the api from.
+	CORS mid.CORSConfig
+
+	// Response bodies of the compressed media types are compressed once they
+	// reach the minimum size.
+	CompressMinSize int
+	CompressTypes   []string
 }
 
 // APIMux constructs a http.Handler with all application routes defined.
@@ -68,17 +108,52 @@ func APIMux(cfg APIMuxConfig) *web.App {
 	app := web.NewApp(
 		cfg.Shutdown,
 		mid.Logger(cfg.Log),
+		mid.CORS(cfg.CORS),
+		web.Compress(cfg.CompressMinSize, cfg.CompressTypes...),
 		mid.Errors(cfg.Log),
 		mid.Metrics(),
-		mid.Panics())
+		mid.Panics(),
+		mid.Timeout(cfg.RequestTimeout),
+		web.LimitBody(cfg.MaxBodyBytes))
+
+	// Answer the preflight requests browsers send before calling the api
+	// from another origin.
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		app.Options(options)
+	}
+
+	// Publish the keys used to verify our tokens.
+	kgh := keygrp.Handlers{
+		Issuer:    cfg.Issuer,
+		PublicURL: cfg.URL,
+		Keys:      cfg.Keys,
+	}
+	wellKnown := app.Group("/.well-known")
+	wellKnown.Handle(http.MethodGet, "/jwks.json", kgh.JWKS)
+	wellKnown.Handle(http.MethodGet, "/openid-configuration", kgh.Configuration)
 
 	// Load the v1 routes.
 	v1.Routes(app, v1.Config{
-		Log:  cfg.Log,
-		Auth: cfg.Auth,
-		DB:   cfg.DB,
+		Log:    cfg.Log,
+		Auth:   cfg.Auth,
+		Keys:   cfg.Keys,
+		Policy: cfg.Policy,
+		Hasher: cfg.Hasher,
+		DB:     cfg.DB,
+		OIDC:   cfg.OIDC,
+
+		OIDCLanding:   cfg.OIDCLanding,
+		SessionGroups: cfg.SessionGroups,
+		SecureCookies: cfg.SecureCookies,
+		RateLimits:    cfg.RateLimits,
 	})
 
 	return app
 }
 
+// options responds to OPTIONS requests which aren't preflight requests of an
+// allowed origin.
+func options(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
@@ -0,0 +1,156 @@
+// Package authgrp maintains the group of handlers for managing the keys used
+// to sign and validate tokens and for introspecting tokens.
+package authgrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/validate"
+	"github.com/asishcse60/service/foundation/keystore"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// Handlers manages the set of key and token endpoints.
+type Handlers struct {
+	Auth    *auth.Auth
+	Keys    *keystore.KeyStore
+	Checker auth.ClaimsChecker
+}
+
+// QueryKeys returns the keys held by the key store and the active KID.
+func (h Handlers) QueryKeys(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	resp := struct {
+		ActiveKID string         `json:"active_kid"`
+		Keys      []keystore.Key `json:"keys"`
+	}{
+		ActiveKID: h.Auth.ActiveKID(),
+		Keys:      h.Keys.Keys(),
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// SetActiveKey switches the key used to sign new tokens.
+func (h Handlers) SetActiveKey(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var ak struct {
+		KID string `json:"kid" validate:"required"`
+	}
+	if err := web.Decode(r, &ak); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := validate.Check(ak); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+
+	if err := h.Auth.SetActiveKID(ak.KID); err != nil {
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// ReloadKeys reads the keys folder again to pick up new keys and retire the
+// ones that were removed.
+func (h Handlers) ReloadKeys(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := h.Keys.Reload(); err != nil {
+		return fmt.Errorf("reloading keys: %w", err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// RetireKey stops a key from signing new tokens. The key continues to
+// validate tokens until its grace period has passed.
+func (h Handlers) RetireKey(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	kid := web.Param(r, "kid")
+	if kid == h.Auth.ActiveKID() {
+		err := errors.New("the active key can't be retired")
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if err := h.Keys.Retire(kid); err != nil {
+		return validate.NewRequestError(err, http.StatusNotFound)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// introspection represents the response of the introspect endpoint as
+// defined by RFC 7662. Only the active field is set for inactive tokens.
+type introspection struct {
+	Active    bool        `json:"active"`
+	Scope     string      `json:"scope,omitempty"`
+	TokenType string      `json:"token_type,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Issuer    string      `json:"iss,omitempty"`
+	Audience  []string    `json:"aud,omitempty"`
+	ExpiresAt int64       `json:"exp,omitempty"`
+	IssuedAt  int64       `json:"iat,omitempty"`
+	NotBefore int64       `json:"nbf,omitempty"`
+	Roles     []string    `json:"roles,omitempty"`
+	Actor     *auth.Actor `json:"act,omitempty"`
+}
+
+// Introspect reports whether the token in the token form parameter is
+// active and the claims it carries. A token is inactive when it can't be
+// validated or when it was revoked or belongs to a suspended account. The
+// reason a token is inactive is never disclosed.
+func (h Handlers) Introspect(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return validate.NewRequestError(fmt.Errorf("parsing form: %w", err), http.StatusBadRequest)
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		err := errors.New("must provide the token form parameter")
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// The response must not be cached as the state of a token can change.
+	w.Header().Set("Cache-Control", "no-store")
+
+	claims, err := h.Auth.ValidateToken(token)
+	if err != nil {
+		return web.Respond(ctx, w, introspection{}, http.StatusOK)
+	}
+
+	if h.Checker != nil && !h.Auth.External(claims) {
+		if err := h.Checker.CheckClaims(ctx, claims); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrRevoked),
+				errors.Is(err, database.ErrAccountSuspended):
+				return web.Respond(ctx, w, introspection{}, http.StatusOK)
+			default:
+				return fmt.Errorf("checking claims: %w", err)
+			}
+		}
+	}
+
+	resp := introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		TokenType: "Bearer",
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		Roles:     claims.Roles,
+		Actor:     claims.Actor,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	if claims.NotBefore != nil {
+		resp.NotBefore = claims.NotBefore.Unix()
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
@@ -0,0 +1,162 @@
+// Package oidcgrp maintains the group of handlers that let users log in
+// through an external OpenID Connect provider.
+package oidcgrp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	userCore "github.com/asishcse60/service/business/core/user"
+	"github.com/asishcse60/service/business/data/store/user"
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/oidc"
+	"github.com/asishcse60/service/business/sys/validate"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// flowCookie holds the state, nonce and PKCE verifier of a login in progress.
+const flowCookie = "oidc"
+
+// flowTTL is how long a user has to complete the login with the provider.
+const flowTTL = 10 * time.Minute
+
+// Handlers manages the set of OpenID Connect endpoints. Once logged in the
+// browser is sent to the landing page with a session.
+type Handlers struct {
+	Provider      *oidc.Provider
+	User          userCore.Core
+	Auth          *auth.Auth
+	SecureCookies bool
+	Landing       string
+}
+
+// Login redirects the user to the provider to log in. The values needed to
+// complete the login are kept in a short lived cookie.
+func (h Handlers) Login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	state, err := oidc.NewRandom()
+	if err != nil {
+		return err
+	}
+	nonce, err := oidc.NewRandom()
+	if err != nil {
+		return err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return err
+	}
+
+	// The provider redirects back with a top level navigation so the cookie
+	// must be sent on cross site requests.
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Value:    strings.Join([]string{state, nonce, verifier}, "."),
+		Path:     "/",
+		MaxAge:   int(flowTTL.Seconds()),
+		Secure:   h.SecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, h.Provider.AuthCodeURL(state, nonce, challenge), http.StatusFound)
+
+	return web.SetStatusCode(ctx, http.StatusFound)
+}
+
+// Callback completes the login once the provider redirects back. The user
+// linked to the identity is found or provisioned and the session cookies are
+// set before redirecting to the landing page.
+func (h Handlers) Callback(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		err := fmt.Errorf("provider denied the login: %s %s", e, q.Get("error_description"))
+		return validate.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	cookie, err := r.Cookie(flowCookie)
+	if err != nil {
+		err := errors.New("no login is in progress")
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// The values of a flow can only be used once.
+	http.SetCookie(w, &http.Cookie{
+		Name:     flowCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   h.SecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	flow := strings.Split(cookie.Value, ".")
+	if len(flow) != 3 || subtle.ConstantTimeCompare([]byte(flow[0]), []byte(q.Get("state"))) != 1 {
+		err := errors.New("state does not match the login in progress")
+		return validate.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	id, err := h.Provider.Exchange(ctx, q.Get("code"), flow[2], flow[1])
+	if err != nil {
+		return validate.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	ni := user.NewIdentity{
+		Issuer:        id.Issuer,
+		Subject:       id.Subject,
+		Email:         id.Email,
+		EmailVerified: id.EmailVerified,
+		Name:          id.Name,
+	}
+
+	claims, err := h.User.AuthenticateIdentity(ctx, v.Now, ni)
+	if err != nil {
+		var fieldErrors validate.FieldErrors
+		if errors.As(err, &fieldErrors) {
+			err := errors.New("provider did not share a valid email")
+			return validate.NewRequestError(err, http.StatusUnauthorized)
+		}
+		return fmt.Errorf("authenticating identity: %w", err)
+	}
+
+	claims.CSRF, err = auth.NewCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	token, err := h.Auth.GenerateToken(claims)
+	if err != nil {
+		return fmt.Errorf("generating token: %w", err)
+	}
+
+	expires := claims.ExpiresAt.Time
+	http.SetCookie(w, h.cookie(auth.SessionCookie, token, expires, true))
+	http.SetCookie(w, h.cookie(auth.CSRFCookie, claims.CSRF, expires, false))
+
+	http.Redirect(w, r, h.Landing, http.StatusFound)
+
+	return web.SetStatusCode(ctx, http.StatusFound)
+}
+
+// cookie returns a cookie carrying the session to the browser. The cookies
+// are the same as the ones set by a login with a password.
+func (h Handlers) cookie(name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.SecureCookies,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
@@ -8,11 +8,9 @@ import (
 	"github.com/asishcse60/service/business/data/store/product"
 
 	"net/http"
-	"strconv"
 
 	userProduct "github.com/asishcse60/service/business/core/product"
 	"github.com/asishcse60/service/business/sys/auth"
-	"github.com/asishcse60/service/business/sys/database"
 	"github.com/asishcse60/service/business/sys/validate"
 	"github.com/asishcse60/service/foundation/web"
 )
@@ -47,7 +45,6 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 	return web.Respond(ctx, w, prod, http.StatusCreated)
 }
 
-
 // Update updates a product in the system.
 func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
@@ -65,18 +62,13 @@ func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	if err := h.Product.Update(ctx, claims, id, upd, v.Now); err != nil {
-		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
-			return validate.NewRequestError(err, http.StatusForbidden)
-		default:
-			return fmt.Errorf("ID[%s] User[%+v]: %w", id, &upd, err)
-		}
+		return fmt.Errorf("ID[%s] User[%+v]: %w", id, &upd, err)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -89,14 +81,13 @@ func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return errors.New("claims missing from context")
 	}
 
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	if err := h.Product.Delete(ctx, claims, id); err != nil {
-		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		default:
-			return fmt.Errorf("ID[%s]: %w", id, err)
-		}
+		return fmt.Errorf("ID[%s]: %w", id, err)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -104,18 +95,15 @@ func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Req
 
 // Query returns a list of products with paging.
 func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	page := web.Param(r, "page")
-	pageNumber, err := strconv.Atoi(page)
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid page format, page[%s]", page), http.StatusBadRequest)
+	var qp struct {
+		Page int `param:"page" validate:"min=1"`
+		Rows int `param:"rows" validate:"min=1,max=1000"`
 	}
-	rows := web.Param(r, "rows")
-	rowsPerPage, err := strconv.Atoi(rows)
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid rows format, rows[%s]", rows), http.StatusBadRequest)
+	if err := validate.Bind(r, &qp); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
 	}
 
-	products, err := h.Product.Query(ctx, pageNumber, rowsPerPage)
+	products, err := h.Product.Query(ctx, qp.Page, qp.Rows)
 	if err != nil {
 		return fmt.Errorf("unable to query for products: %w", err)
 	}
@@ -123,20 +111,39 @@ func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Requ
 	return web.Respond(ctx, w, products, http.StatusOK)
 }
 
+// Export streams every product without paging, as a JSON array or as
+// newline delimited JSON.
+func (h Handlers) Export(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	it, err := h.Product.Export(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to export products: %w", err)
+	}
+	defer it.Close()
+
+	next := func() (interface{}, error) {
+		return it.Next()
+	}
+
+	return web.Stream(ctx, w, next, http.StatusOK)
+}
+
 // QueryByID returns a product by its ID.
 func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	prod, err := h.Product.QueryByID(ctx, id)
 	if err != nil {
-		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		default:
-			return fmt.Errorf("ID[%s]: %w", id, err)
-		}
+		return fmt.Errorf("ID[%s]: %w", id, err)
 	}
 
 	return web.Respond(ctx, w, prod, http.StatusOK)
-}
\ No newline at end of file
+}
+
+// idParam binds the id of the product in the path. The id is checked by the
+// store so a malformed one is reported as an invalid id.
+type idParam struct {
+	ID string `param:"id"`
+}
@@ -0,0 +1,94 @@
+// Package rolegrp maintains the group of handlers for role access.
+package rolegrp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	roleCore "github.com/asishcse60/service/business/core/role"
+	"github.com/asishcse60/service/business/data/store/role"
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// Handlers manages the set of role endpoints.
+type Handlers struct {
+	Role roleCore.Core
+}
+
+// Query returns the list of roles.
+func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	roles, err := h.Role.Query(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to query for roles: %w", err)
+	}
+
+	return web.Respond(ctx, w, roles, http.StatusOK)
+}
+
+// Create adds a new role to the system.
+func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	var nr role.NewRole
+	if err := web.Decode(r, &nr); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	rol, err := h.Role.Create(ctx, claims, nr, v.Now)
+	if err != nil {
+		return fmt.Errorf("creating new role, nr[%+v]: %w", nr, err)
+	}
+
+	return web.Respond(ctx, w, rol, http.StatusCreated)
+}
+
+// Update replaces the permissions of a role in the system.
+func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	var upd role.UpdateRole
+	if err := web.Decode(r, &upd); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	name := web.Param(r, "name")
+	if err := h.Role.Update(ctx, claims, name, upd, v.Now); err != nil {
+		return fmt.Errorf("Name[%s] Role[%+v]: %w", name, &upd, err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// Delete removes a role from the system.
+func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	name := web.Param(r, "name")
+	if err := h.Role.Delete(ctx, claims, name); err != nil {
+		return fmt.Errorf("Name[%s]: %w", name, err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
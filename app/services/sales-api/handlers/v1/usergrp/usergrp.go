@@ -6,7 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
 	userCore "github.com/asishcse60/service/business/core/user"
 	"github.com/asishcse60/service/business/data/store/user"
@@ -18,24 +19,23 @@ import (
 
 // Handlers manages the set of user enpoints.
 type Handlers struct {
-	User userCore.Core
-	Auth *auth.Auth
+	User          userCore.Core
+	Auth          *auth.Auth
+	Policy        *auth.Policy
+	SecureCookies bool
 }
 
 // Query returns a list of users with paging.
 func (h Handlers) Query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	page := web.Param(r, "page")
-	pageNumber, err := strconv.Atoi(page)
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid page format [%s]", page), http.StatusBadRequest)
+	var qp struct {
+		Page int `param:"page" validate:"min=1"`
+		Rows int `param:"rows" validate:"min=1,max=1000"`
 	}
-	rows := web.Param(r, "rows")
-	rowsPerPage, err := strconv.Atoi(rows)
-	if err != nil {
-		return validate.NewRequestError(fmt.Errorf("invalid rows format [%s]", rows), http.StatusBadRequest)
+	if err := validate.Bind(r, &qp); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
 	}
 
-	users, err := h.User.Query(ctx, pageNumber, rowsPerPage)
+	users, err := h.User.Query(ctx, qp.Page, qp.Rows)
 	if err != nil {
 		return fmt.Errorf("unable to query for users: %w", err)
 	}
@@ -50,22 +50,55 @@ func (h Handlers) QueryByID(ctx context.Context, w http.ResponseWriter, r *http.
 		return errors.New("claims missing from context")
 	}
 
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	usr, err := h.User.QueryByID(ctx, claims, id)
 	if err != nil {
+		return fmt.Errorf("ID[%s]: %w", id, err)
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+// QueryMe returns the profile of the caller along with the roles and the
+// permissions the token can exercise. The profile is omitted when the token
+// doesn't belong to a local account or its scope doesn't allow reading it.
+func (h Handlers) QueryMe(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	resp := struct {
+		User        *user.User  `json:"user,omitempty"`
+		Subject     string      `json:"subject"`
+		Actor       *auth.Actor `json:"actor,omitempty"`
+		Roles       []string    `json:"roles"`
+		Scopes      []string    `json:"scopes,omitempty"`
+		Permissions []string    `json:"permissions"`
+	}{
+		Subject:     claims.Subject,
+		Actor:       claims.Actor,
+		Roles:       claims.Roles,
+		Scopes:      claims.Scopes(),
+		Permissions: h.Policy.Effective(claims),
+	}
+
+	if !h.Auth.External(claims) {
+		usr, err := h.User.QueryByID(ctx, claims, claims.Subject)
 		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
-			return validate.NewRequestError(err, http.StatusForbidden)
+		case nil:
+			resp.User = &usr
+		case database.ErrInvalidID, database.ErrNotFound, database.ErrForbidden:
 		default:
-			return fmt.Errorf("ID[%s]: %w", id, err)
+			return fmt.Errorf("ID[%s]: %w", claims.Subject, err)
 		}
 	}
 
-	return web.Respond(ctx, w, usr, http.StatusOK)
+	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
 // Create adds a new user to the system.
@@ -75,12 +108,17 @@ func (h Handlers) Create(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return web.NewShutdownError("web value missing from context")
 	}
 
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
 	var nu user.NewUser
 	if err := web.Decode(r, &nu); err != nil {
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
-	usr, err := h.User.Create(ctx, nu, v.Now)
+	usr, err := h.User.Create(ctx, claims, nu, v.Now)
 	if err != nil {
 		return fmt.Errorf("user[%+v]: %w", &usr, err)
 	}
@@ -105,18 +143,42 @@ func (h Handlers) Update(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	if err := h.User.Update(ctx, claims, id, upd, v.Now); err != nil {
-		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
-			return validate.NewRequestError(err, http.StatusForbidden)
-		default:
-			return fmt.Errorf("ID[%s] User[%+v]: %w", id, &upd, err)
-		}
+		return fmt.Errorf("ID[%s] User[%+v]: %w", id, &upd, err)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// UpdateStatus suspends or reactivates a user in the system.
+func (h Handlers) UpdateStatus(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	var us user.UpdateStatus
+	if err := web.Decode(r, &us); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
+	if err := h.User.UpdateStatus(ctx, claims, id, us, v.Now); err != nil {
+		return fmt.Errorf("ID[%s] Status[%+v]: %w", id, &us, err)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
@@ -129,46 +191,59 @@ func (h Handlers) Delete(ctx context.Context, w http.ResponseWriter, r *http.Req
 		return errors.New("claims missing from context")
 	}
 
-	id := web.Param(r, "id")
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
 	if err := h.User.Delete(ctx, claims, id); err != nil {
-		switch validate.Cause(err) {
-		case database.ErrInvalidID:
-			return validate.NewRequestError(err, http.StatusBadRequest)
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrForbidden:
-			return validate.NewRequestError(err, http.StatusForbidden)
-		default:
-			return fmt.Errorf("ID[%s]: %w", id, err)
-		}
+		return fmt.Errorf("ID[%s]: %w", id, err)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusNoContent)
 }
 
-// Token provides an API token for the authenticated user.
-func (h Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+// Impersonate provides a short lived API token that allows an admin to act
+// as the specified user. Destructive operations are denied for the token.
+func (h Handlers) Impersonate(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
 	if err != nil {
 		return web.NewShutdownError("web value missing from context")
 	}
 
-	email, pass, ok := r.BasicAuth()
-	if !ok {
-		err := errors.New("must provide email and password in Basic auth")
-		return validate.NewRequestError(err, http.StatusUnauthorized)
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
 	}
 
-	claims, err := h.User.Authenticate(ctx, v.Now, email, pass)
+	var path idParam
+	if err := validate.Bind(r, &path); err != nil {
+		return fmt.Errorf("binding parameters: %w", err)
+	}
+	id := path.ID
+	imp, err := h.User.Impersonate(ctx, claims, id, v.Now)
 	if err != nil {
-		switch validate.Cause(err) {
-		case database.ErrNotFound:
-			return validate.NewRequestError(err, http.StatusNotFound)
-		case database.ErrAuthenticationFailure:
-			return validate.NewRequestError(err, http.StatusUnauthorized)
-		default:
-			return fmt.Errorf("authenticating: %w", err)
-		}
+		return fmt.Errorf("ID[%s]: %w", id, err)
+	}
+
+	var tkn struct {
+		Token string `json:"token"`
+	}
+	tkn.Token, err = h.Auth.GenerateToken(imp)
+	if err != nil {
+		return fmt.Errorf("generating token: %w", err)
+	}
+
+	return web.Respond(ctx, w, tkn, http.StatusOK)
+}
+
+// Token provides an API token for the authenticated user. The token can be
+// restricted by providing one or more scope query parameters, each holding
+// a space delimited list of permissions.
+func (h Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := h.authenticate(ctx, r)
+	if err != nil {
+		return err
 	}
 
 	var tkn struct {
@@ -181,3 +256,124 @@ func (h Handlers) Token(ctx context.Context, w http.ResponseWriter, r *http.Requ
 
 	return web.Respond(ctx, w, tkn, http.StatusOK)
 }
+
+// Login starts a session for browser clients. The token is stored in an
+// HttpOnly cookie and bound to a CSRF token that is returned in the body and
+// in a cookie scripts can read. Requests using unsafe methods must echo the
+// CSRF token in the CSRF header.
+func (h Handlers) Login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, err := h.authenticate(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	claims.CSRF, err = auth.NewCSRFToken()
+	if err != nil {
+		return err
+	}
+
+	token, err := h.Auth.GenerateToken(claims)
+	if err != nil {
+		return fmt.Errorf("generating token: %w", err)
+	}
+
+	expires := claims.ExpiresAt.Time
+	http.SetCookie(w, h.cookie(auth.SessionCookie, token, expires, true))
+	http.SetCookie(w, h.cookie(auth.CSRFCookie, claims.CSRF, expires, false))
+
+	resp := struct {
+		CSRFToken string    `json:"csrf_token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{
+		CSRFToken: claims.CSRF,
+		ExpiresAt: expires,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// Logout ends the session of a browser client by expiring its cookies. Only
+// this session ends, the token it carried stays valid until it expires. Use
+// LogoutAll to revoke every token of the user.
+func (h Handlers) Logout(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	h.expireSession(w)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// LogoutAll logs the user out everywhere by revoking every token issued to
+// the user, including the ones of other sessions and API tokens. The cookies
+// of a browser client are expired as well. Impersonation sessions can't log
+// the impersonated user out everywhere.
+func (h Handlers) LogoutAll(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, err := auth.GetClaims(ctx)
+	if err != nil {
+		return errors.New("claims missing from context")
+	}
+
+	if err := h.User.Revoke(ctx, claims, v.Now); err != nil {
+		return fmt.Errorf("revoking tokens: %w", err)
+	}
+
+	h.expireSession(w)
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// expireSession tells browser clients to drop the session cookies.
+func (h Handlers) expireSession(w http.ResponseWriter) {
+	http.SetCookie(w, h.cookie(auth.SessionCookie, "", time.Unix(0, 0), true))
+	http.SetCookie(w, h.cookie(auth.CSRFCookie, "", time.Unix(0, 0), false))
+}
+
+// authenticate verifies the email and password provided in Basic auth and
+// returns the claims for the user, restricted to the requested scopes.
+func (h Handlers) authenticate(ctx context.Context, r *http.Request) (auth.Claims, error) {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return auth.Claims{}, web.NewShutdownError("web value missing from context")
+	}
+
+	email, pass, ok := r.BasicAuth()
+	if !ok {
+		err := errors.New("must provide email and password in Basic auth")
+		return auth.Claims{}, validate.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	var scopes []string
+	for _, scope := range r.URL.Query()["scope"] {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+
+	claims, err := h.User.Authenticate(ctx, v.Now, email, pass, scopes...)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("authenticating: %w", err)
+	}
+
+	return claims, nil
+}
+
+// cookie constructs a session cookie. Cookies are only sent over TLS unless
+// secure cookies are disabled for local development.
+func (h Handlers) cookie(name string, value string, expires time.Time, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   h.SecureCookies,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// idParam binds the id of the user in the path. The id is checked by the
+// store so a malformed one is reported as an invalid id.
+type idParam struct {
+	ID string `param:"id"`
+}
@@ -3,63 +3,209 @@
 package v1
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
 
+	v1AuthGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/authgrp"
+	v1OIDCGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/oidcgrp"
 	v1ProductGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/productgrp"
+	v1RoleGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/rolegrp"
 	v1TestGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/testgrp"
 	v1UserGrp "github.com/asishcse60/service/app/services/sales-api/handlers/v1/usergrp"
 	"github.com/asishcse60/service/business/core/product"
+	"github.com/asishcse60/service/business/core/role"
 	"github.com/asishcse60/service/business/core/user"
 	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/oidc"
+	"github.com/asishcse60/service/business/sys/password"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+	"github.com/asishcse60/service/business/sys/validate"
 	"github.com/asishcse60/service/business/web/v1/mid"
+	"github.com/asishcse60/service/foundation/keystore"
 	"github.com/asishcse60/service/foundation/web"
 )
 
 // Config contains all the mandatory systems required by handlers.
 type Config struct {
-	Log  *zap.SugaredLogger
-	Auth *auth.Auth
-	DB   *sqlx.DB
+	Log    *zap.SugaredLogger
+	Auth   *auth.Auth
+	Keys   *keystore.KeyStore
+	Policy *auth.Policy
+	Hasher password.Hasher
+	DB     *sqlx.DB
+	OIDC   *oidc.Provider
+
+	// OIDCLanding is the page browsers are sent to once logged in through
+	// the OpenID Connect provider.
+	OIDCLanding string
+
+	// SessionGroups lists the route groups that accept the session cookie
+	// issued to browser clients in addition to bearer tokens.
+	SessionGroups []string
+	SecureCookies bool
+
+	// RateLimits describes how the clients of the rate limit policies are
+	// told apart and where their buckets are kept.
+	RateLimits mid.RateLimitConfig
 }
 
+// maxEntityBytes limits the body of the routes creating and updating
+// entities, which are small documents compared to what the app accepts.
+const maxEntityBytes = 64 << 10
+
+// Rate limit policies of the routes. Routes verifying passwords have a strict
+// limit for each client and each email to slow down guessing, the other
+// routes share a limit for each user.
+var (
+	signinLimit = ratelimit.Limit{Rate: 5, Per: time.Minute, Burst: 5}
+	apiLimit    = ratelimit.Limit{Rate: 50, Per: time.Second, Burst: 100}
+	exportLimit = ratelimit.Limit{Rate: 10, Per: time.Minute, Burst: 2}
+)
+
 // Routes binds all the version 1 routes.
 func Routes(app *web.App, cfg Config) {
 	const version = "v1"
 
-	authen := mid.Authenticate(cfg.Auth)
-	admin := mid.Authorize(auth.RoleAdmin)
+	usrCore := user.NewCore(cfg.Log, cfg.DB, cfg.Policy, cfg.Hasher)
+
+	// Route groups used by browser clients can be authenticated with a
+	// session cookie instead of a bearer token.
+	bearer := mid.Authenticate(cfg.Auth, usrCore)
+	session := mid.AuthenticateSession(cfg.Auth, usrCore)
+	sessions := make(map[string]bool)
+	for _, group := range cfg.SessionGroups {
+		sessions[group] = true
+	}
+	authen := func(group string) web.Middleware {
+		if sessions[group] {
+			return session
+		}
+		return bearer
+	}
+	can := func(perms ...string) web.Middleware {
+		return mid.RequirePermission(cfg.Policy, perms...)
+	}
+	entity := web.LimitBody(maxEntityBytes)
+	limit := func(policy string, l ratelimit.Limit) web.Middleware {
+		return mid.RateLimit(cfg.Log, cfg.RateLimits, policy, l)
+	}
+	signin := limit("signin", signinLimit)
+	signinEmail := mid.RateLimitEmail(cfg.Log, cfg.RateLimits, "signin", signinLimit)
+	api := limit("api", apiLimit)
+
+	// Exports stream for as long as the client keeps reading them. The write
+	// timeout of the server applies to each batch of rows instead of the
+	// whole export, and the export stops when the client goes away instead
+	// of after the timeout of the app.
+	noTimeout := mid.Timeout(0)
+
+	v1 := app.Group("/" + version)
+	v1.NotFound(notFound)
+	v1.MethodNotAllowed(methodNotAllowed)
 
 	// test endpoints.
 	tgh := v1TestGrp.Handlers{
 		Log: cfg.Log,
 	}
 
-	app.Handle(http.MethodGet, version, "/test", tgh.Test)
-	app.Handle(http.MethodGet, version, "/testauth", tgh.Test, mid.Authenticate(cfg.Auth), mid.Authorize("ADMIN"))
+	v1.Handle(http.MethodGet, "/test", tgh.Test)
+	v1.Handle(http.MethodGet, "/testauth", tgh.Test, authen("test"), mid.Authorize("ADMIN"))
 
 	// Register user management and authentication endpoints.
 	ugh := v1UserGrp.Handlers{
-		User: user.NewCore(cfg.Log, cfg.DB),
-		Auth: cfg.Auth,
+		User:          usrCore,
+		Auth:          cfg.Auth,
+		Policy:        cfg.Policy,
+		SecureCookies: cfg.SecureCookies,
 	}
 
-	app.Handle(http.MethodGet, version, "/users/token", ugh.Token)
-	app.Handle(http.MethodGet, version, "/users/:page/:rows", ugh.Query, authen, admin)
-	app.Handle(http.MethodGet, version, "/users/:id", ugh.QueryByID, authen)
-	app.Handle(http.MethodPost, version, "/users", ugh.Create, authen, admin)
-	app.Handle(http.MethodPut, version, "/users/:id", ugh.Update, authen, admin)
-	app.Handle(http.MethodDelete, version, "/users/:id", ugh.Delete, authen, admin)
+	users := v1.Group("/users")
+	users.Handle(http.MethodGet, "/token", ugh.Token, signin, signinEmail)
+	users.Handle(http.MethodPost, "/session", ugh.Login, signin, signinEmail)
+	users.Handle(http.MethodDelete, "/session", ugh.Logout, session)
+	users.Handle(http.MethodDelete, "/sessions", ugh.LogoutAll, session)
+
+	usersAuth := users.Group("", authen("users"), api)
+	usersAuth.Handle(http.MethodGet, "/me", ugh.QueryMe)
+	usersAuth.Handle(http.MethodGet, "/:page/:rows", ugh.Query, can(auth.PermUserList))
+	usersAuth.Handle(http.MethodGet, "/:id", ugh.QueryByID, can(auth.PermUserReadAny, auth.PermUserReadOwn))
+	usersAuth.Handle(http.MethodPost, "", ugh.Create, entity, can(auth.PermUserCreate))
+	usersAuth.Handle(http.MethodPut, "/:id", ugh.Update, entity, can(auth.PermUserUpdateAny))
+	usersAuth.Handle(http.MethodPut, "/:id/status", ugh.UpdateStatus, entity, can(auth.PermUserUpdateAny))
+	usersAuth.Handle(http.MethodPost, "/:id/impersonate", ugh.Impersonate, can(auth.PermUserImpersonate))
+	usersAuth.Handle(http.MethodDelete, "/:id", ugh.Delete, can(auth.PermUserDeleteAny))
+
+	// Register the endpoints to log in through an OpenID Connect provider
+	// when one is configured.
+	if cfg.OIDC != nil {
+		ogh := v1OIDCGrp.Handlers{
+			Provider:      cfg.OIDC,
+			User:          usrCore,
+			Auth:          cfg.Auth,
+			SecureCookies: cfg.SecureCookies,
+			Landing:       cfg.OIDCLanding,
+		}
+
+		idp := v1.Group("/oidc")
+		idp.Handle(http.MethodGet, "/login", ogh.Login)
+		idp.Handle(http.MethodGet, "/callback", ogh.Callback)
+	}
 
 	// Register product and sale endpoints.
 	pgh := v1ProductGrp.Handlers{
-		Product: product.NewCore(cfg.Log, cfg.DB),
+		Product: product.NewCore(cfg.Log, cfg.DB, cfg.Policy),
+	}
+
+	products := v1.Group("/products", authen("products"), api)
+	products.Handle(http.MethodGet, "/:page/:rows", pgh.Query, can(auth.PermProductRead))
+	products.Handle(http.MethodGet, "/export", pgh.Export, noTimeout, limit("export", exportLimit), can(auth.PermProductRead))
+	products.Handle(http.MethodGet, "/:id", pgh.QueryByID, can(auth.PermProductRead))
+	products.Handle(http.MethodPost, "", pgh.Create, entity, can(auth.PermProductCreate))
+	products.Handle(http.MethodPut, "/:id", pgh.Update, entity, can(auth.PermProductUpdateAny, auth.PermProductUpdateOwn))
+	products.Handle(http.MethodDelete, "/:id", pgh.Delete, can(auth.PermProductDelete))
+
+	// Register role management endpoints.
+	rgh := v1RoleGrp.Handlers{
+		Role: role.NewCore(cfg.Log, cfg.DB, cfg.Policy),
+	}
+
+	roles := v1.Group("/roles", authen("roles"), api, can(auth.PermRoleManage))
+	roles.Handle(http.MethodGet, "", rgh.Query)
+	roles.Handle(http.MethodPost, "", rgh.Create, entity)
+	roles.Handle(http.MethodPut, "/:name", rgh.Update, entity)
+	roles.Handle(http.MethodDelete, "/:name", rgh.Delete)
+
+	// Register key management and token introspection endpoints.
+	agh := v1AuthGrp.Handlers{
+		Auth:    cfg.Auth,
+		Keys:    cfg.Keys,
+		Checker: usrCore,
 	}
-	app.Handle(http.MethodGet, version, "/products/:page/:rows", pgh.Query, authen)
-	app.Handle(http.MethodGet, version, "/products/:id", pgh.QueryByID, authen)
-	app.Handle(http.MethodPost, version, "/products", pgh.Create, authen)
-	app.Handle(http.MethodPut, version, "/products/:id", pgh.Update, authen)
-	app.Handle(http.MethodDelete, version, "/products/:id", pgh.Delete, authen)
-}
\ No newline at end of file
+
+	authGrp := v1.Group("/auth", authen("auth"), api)
+	authGrp.Handle(http.MethodPost, "/introspect", agh.Introspect, can(auth.PermTokenIntrospect))
+
+	keys := authGrp.Group("/keys", can(auth.PermKeyManage))
+	keys.Handle(http.MethodGet, "", agh.QueryKeys)
+	keys.Handle(http.MethodPut, "/active", agh.SetActiveKey)
+	keys.Handle(http.MethodPost, "/reload", agh.ReloadKeys)
+	keys.Handle(http.MethodDelete, "/:kid", agh.RetireKey)
+}
+
+// notFound responds to requests for a route the version 1 api doesn't have.
+func notFound(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := fmt.Errorf("route %s not found", r.URL.Path)
+	return validate.NewRequestError(err, http.StatusNotFound)
+}
+
+// methodNotAllowed responds to requests using a method the route doesn't
+// support.
+func methodNotAllowed(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	err := fmt.Errorf("method %s not allowed for route %s", r.Method, r.URL.Path)
+	return validate.NewRequestError(err, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,55 @@
+// Package keygrp maintains the group of handlers that publish the public keys
+// used to verify the tokens issued by this service.
+package keygrp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/asishcse60/service/foundation/keystore"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// KeySet declares the behavior required to publish a set of public keys.
+type KeySet interface {
+	JWKS() keystore.JWKS
+}
+
+// Handlers manages the set of key endpoints. The endpoints listed in the
+// discovery document are relative to the public URL the service is reached
+// at, which can't be trusted from the request since the document is cached.
+type Handlers struct {
+	Issuer    string
+	PublicURL string
+	Keys      KeySet
+}
+
+// JWKS returns the public keys verifiers need to validate our tokens. Every
+// key that can still validate a token is published so verifiers pick up a
+// rotated key before it is used to sign.
+func (h Handlers) JWKS(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	return web.Respond(ctx, w, h.Keys.JWKS(), http.StatusOK)
+}
+
+// Configuration returns the discovery document telling verifiers who issues
+// our tokens and where the keys to verify them can be found. The service
+// isn't an authorization server, it has no authorization endpoint, so only
+// the issuer and the location of the keys are published.
+func (h Handlers) Configuration(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	base := strings.TrimSuffix(h.PublicURL, "/")
+
+	doc := struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}{
+		Issuer:  h.Issuer,
+		JWKSURI: base + "/.well-known/jwks.json",
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	return web.Respond(ctx, w, doc, http.StatusOK)
+}
@@ -23,10 +23,18 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/asishcse60/service/app/services/sales-api/handlers"
+	"github.com/asishcse60/service/business/core/role"
+	"github.com/asishcse60/service/business/data/store/bucket"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/oidc"
+	"github.com/asishcse60/service/business/sys/password"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+	"github.com/asishcse60/service/business/sys/validate"
+	"github.com/asishcse60/service/business/web/v1/mid"
 	"github.com/asishcse60/service/foundation/keystore"
 	"github.com/asishcse60/service/foundation/logger"
+	"github.com/asishcse60/service/foundation/web"
 )
 
 // build is the git version of this program. It is set using build flags in the makefile.
@@ -68,7 +76,22 @@ func run(log *zap.SugaredLogger) error {
 			IdleTimeout     time.Duration `conf:"default:120s"`
 			ShutdownTimeout time.Duration `conf:"default:20s"`
 			APIHost         string        `conf:"default:0.0.0.0:3000"`
+			PublicURL       string        `conf:"default:http://localhost:3000,help:url clients reach the api at"`
 			DebugHost       string        `conf:"default:0.0.0.0:4000"`
+			SessionGroups   []string      `conf:"help:v1 route groups that accept session cookies (users;products;roles;auth)"`
+			SecureCookies   bool          `conf:"default:true"`
+			MaxBodyBytes    int64         `conf:"default:1048576"`
+			RequestTimeout  time.Duration `conf:"default:5s"`
+			CompressMinSize int           `conf:"default:1024"`
+			CompressTypes   []string      `conf:"default:application/json;application/x-ndjson;application/xml;application/problem+json;application/problem+xml;text/csv"`
+		}
+		CORS struct {
+			AllowedOrigins   []string      `conf:"help:origins browsers can call the api from (https://app.example.com;https://*.example.com)"`
+			AllowedMethods   []string      `conf:"default:GET;POST;PUT;DELETE"`
+			AllowedHeaders   []string      `conf:"default:Accept;Authorization;Content-Type;X-CSRF-Token"`
+			ExposedHeaders   []string      `conf:"default:RateLimit-Limit;RateLimit-Remaining;RateLimit-Reset;Retry-After"`
+			AllowCredentials bool          `conf:"default:false,help:allow browsers to send the session cookie"`
+			MaxAge           time.Duration `conf:"default:1h,help:time browsers can cache the answer to a preflight request"`
 		}
 		DB struct {
 			User         string `conf:"default:postgres"`
@@ -85,8 +108,47 @@ func run(log *zap.SugaredLogger) error {
 			Probability float64 `conf:"default:0.05"`
 		}
 		Auth struct {
-			KeysFolder string `conf:"default:zarf/keys/"`
-			ActiveKID  string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+			KeysFolder     string        `conf:"default:zarf/keys/"`
+			ActiveKID      string        `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
+			Issuer         string        `conf:"default:service project"`
+			Audience       string        `conf:"default:sales-api"`
+			Leeway         time.Duration `conf:"default:30s,help:clock skew allowed when validating tokens"`
+			KeysPoll       time.Duration `conf:"default:1m,help:interval to check the keys folder for new keys (0 disables)"`
+			PolicyPoll     time.Duration `conf:"default:1m,help:interval to reload the roles changed by other instances (0 disables)"`
+			KeysGrace      time.Duration `conf:"default:2h,help:time retired keys continue to validate tokens"`
+			Passphrase     string        `conf:"mask,help:passphrase to decrypt encrypted key files"`
+			PassphraseFile string        `conf:"help:secrets file holding the passphrase to decrypt encrypted key files"`
+		}
+		Trusted struct {
+			Issuer   string        `conf:"help:issuer of the tokens of a trusted identity provider"`
+			Audience string        `conf:"help:audience the tokens of the identity provider must be meant for"`
+			JWKSURL  string        `conf:"help:url of the JWKS document of the identity provider"`
+			Roles    []string      `conf:"default:USER,help:roles granted to the tokens of the provider"`
+			TTL      time.Duration `conf:"default:1h"`
+		}
+		OIDC struct {
+			Issuer       string   `conf:"help:issuer of the OpenID Connect provider users can log in with"`
+			ClientID     string   `conf:"help:client id registered with the provider"`
+			ClientSecret string   `conf:"mask"`
+			RedirectURL  string   `conf:"default:http://localhost:3000/v1/oidc/callback"`
+			Landing      string   `conf:"default:/,help:page browsers are sent to once logged in"`
+			Scopes       []string `conf:"default:openid;email;profile"`
+		}
+		RateLimit struct {
+			Store        string        `conf:"default:memory,help:where the buckets of the clients are kept (memory;postgres;none)"`
+			PurgeAfter   time.Duration `conf:"default:1h,help:time unused buckets are kept in postgres (0 keeps them)"`
+			ProxyHeader  string        `conf:"help:header a trusted proxy puts the client address in like X-Forwarded-For"`
+			APIKeyHeader string        `conf:"help:header carrying the api key of the client"`
+		}
+		Password struct {
+			MinLength       int    `conf:"default:8"`
+			MaxLength       int    `conf:"default:128"`
+			BreachedFile    string `conf:"help:file with one known breached password per line"`
+			HashMemory      uint32 `conf:"default:19456"`
+			HashIterations  uint32 `conf:"default:2"`
+			HashParallelism uint8  `conf:"default:1"`
+			HashWorkers     int    `conf:"default:0,help:number of hashing workers or 0 to use GOMAXPROCS"`
+			HashQueue       int    `conf:"default:64"`
 		}
 	}{
 		Version: conf.Version{
@@ -116,6 +178,21 @@ func run(log *zap.SugaredLogger) error {
 	}
 	log.Infow("startup", "config", out)
 	expvar.NewString("build").Set(build)
+
+	// Check the origins browsers can call the api from before anything is
+	// started, a mistake there exposes the users of the browsers.
+	cors := mid.CORSConfig{
+		AllowedOrigins:   cfg.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.CORS.AllowedHeaders,
+		ExposedHeaders:   cfg.CORS.ExposedHeaders,
+		AllowCredentials: cfg.CORS.AllowCredentials,
+		MaxAge:           cfg.CORS.MaxAge,
+	}
+	if err := cors.Validate(); err != nil {
+		return fmt.Errorf("validating cors config: %w", err)
+	}
+
 	// =========================================================================
 	// Initialize authentication support
 
@@ -123,16 +200,115 @@ func run(log *zap.SugaredLogger) error {
 
 	// Construct a key store based on the key files stored in
 	// the specified directory.
-	ks, err := keystore.NewFS(os.DirFS(cfg.Auth.KeysFolder))
+	ksOpts := []keystore.Option{
+		keystore.WithGrace(cfg.Auth.KeysGrace),
+	}
+	if cfg.Auth.Passphrase != "" || cfg.Auth.PassphraseFile != "" {
+		passphrase, err := keystore.ReadPassphrase(cfg.Auth.Passphrase, cfg.Auth.PassphraseFile)
+		if err != nil {
+			return fmt.Errorf("reading keys passphrase: %w", err)
+		}
+		ksOpts = append(ksOpts, keystore.WithPassphrase(passphrase))
+	}
+
+	ks, err := keystore.NewFS(os.DirFS(cfg.Auth.KeysFolder), ksOpts...)
 	if err != nil {
 		return fmt.Errorf("reading keys: %w", err)
 	}
 
-	auth, err := auth.New(cfg.Auth.ActiveKID, ks)
+	// Pick up keys added to or removed from the folder without a restart.
+	keysCtx, keysCancel := context.WithCancel(context.Background())
+	defer keysCancel()
+	go ks.Poll(keysCtx, cfg.Auth.KeysPoll, func(err error) {
+		log.Errorw("keys", "status", "reloading keys", "ERROR", err)
+	})
+
+	// Start with the built-in roles until the roles stored in the database
+	// can be loaded.
+	policy := auth.DefaultPolicy()
+
+	// Only accept tokens that were issued by us for this service.
+	authOpts := []auth.Option{
+		auth.WithIssuer(cfg.Auth.Issuer),
+		auth.WithAudience(cfg.Auth.Audience),
+		auth.WithLeeway(cfg.Auth.Leeway),
+	}
+
+	// Accept the tokens of a trusted identity provider alongside our own.
+	if cfg.Trusted.Issuer != "" {
+		log.Infow("startup", "status", "trusting identity provider", "issuer", cfg.Trusted.Issuer)
+		authOpts = append(authOpts, auth.WithTrustedSource(auth.Source{
+			Issuer:   cfg.Trusted.Issuer,
+			Audience: cfg.Trusted.Audience,
+			Keys:     keystore.NewRemote(cfg.Trusted.JWKSURL, keystore.WithTTL(cfg.Trusted.TTL)),
+			Roles:    cfg.Trusted.Roles,
+		}))
+	}
+
+	auth, err := auth.New(cfg.Auth.ActiveKID, ks, authOpts...)
 	if err != nil {
 		return fmt.Errorf("constructing auth: %w", err)
 	}
 
+	var provider *oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		log.Infow("startup", "status", "discovering openid connect provider", "issuer", cfg.OIDC.Issuer)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		provider, err = oidc.New(ctx, oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+		if err != nil {
+			return fmt.Errorf("constructing openid connect provider: %w", err)
+		}
+	}
+
+	// =========================================================================
+	// Initialize password support
+
+	log.Infow("startup", "status", "initializing password support")
+
+	passwordPolicy := validate.PasswordPolicy{
+		MinLength: cfg.Password.MinLength,
+		MaxLength: cfg.Password.MaxLength,
+	}
+	if cfg.Password.BreachedFile != "" {
+		f, err := os.Open(cfg.Password.BreachedFile)
+		if err != nil {
+			return fmt.Errorf("opening breached passwords: %w", err)
+		}
+		passwordPolicy.Breached, err = validate.ReadBreachedPasswords(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		log.Infow("startup", "status", "breached passwords loaded", "count", len(passwordPolicy.Breached))
+	}
+	validate.SetPasswordPolicy(passwordPolicy)
+
+	params := password.DefaultParams
+	params.Memory = cfg.Password.HashMemory
+	params.Iterations = cfg.Password.HashIterations
+	params.Parallelism = cfg.Password.HashParallelism
+
+	// Bound the amount of concurrent hashing so a burst of logins can't pin
+	// every core and starve the other endpoints.
+	workers := cfg.Password.HashWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	hasher := password.NewPool(password.Default(params), workers, cfg.Password.HashQueue)
+	defer func() {
+		log.Infow("shutdown", "status", "stopping password hashing pool")
+		hasher.Shutdown()
+	}()
+
 	// =========================================================================
 	// Database Support
 
@@ -156,6 +332,48 @@ func run(log *zap.SugaredLogger) error {
 		db.Close()
 	}()
 
+	// =========================================================================
+	// Initialize authorization support
+
+	log.Infow("startup", "status", "initializing authorization support")
+
+	// Replace the built-in roles with the roles stored in the database when
+	// they are available.
+	roleCore := role.NewCore(log, db, policy)
+	if err := roleCore.LoadPolicy(context.Background()); err != nil {
+		log.Errorw("startup", "status", "using built-in roles", "ERROR", err)
+	}
+
+	// Pick up the roles changed through the other instances of the service.
+	policyCtx, policyCancel := context.WithCancel(context.Background())
+	defer policyCancel()
+	go roleCore.PollPolicy(policyCtx, cfg.Auth.PolicyPoll, func(err error) {
+		log.Errorw("policy", "status", "reloading roles", "ERROR", err)
+	})
+
+	// =========================================================================
+	// Initialize rate limiting support
+
+	log.Infow("startup", "status", "initializing rate limiting support", "store", cfg.RateLimit.Store)
+
+	// Buckets kept in postgres are shared by every instance of the service so
+	// the limits hold no matter which instance serves a client.
+	var limits ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		limits = ratelimit.NewMemory()
+	case "postgres":
+		buckets := bucket.NewStore(log, db)
+		limits = buckets
+
+		purgeCtx, purgeCancel := context.WithCancel(context.Background())
+		defer purgeCancel()
+		go purgeBuckets(purgeCtx, log, buckets, cfg.RateLimit.PurgeAfter)
+	case "none":
+	default:
+		return fmt.Errorf("unknown rate limit store %q", cfg.RateLimit.Store)
+	}
+
 	// =========================================================================
 	// Start Tracing Support
 
@@ -199,7 +417,27 @@ func run(log *zap.SugaredLogger) error {
 		Shutdown: shutdown,
 		Log:      log,
 		Auth:     auth,
+		Issuer:   cfg.Auth.Issuer,
+		URL:      cfg.Web.PublicURL,
+		Keys:     ks,
+		Policy:   policy,
+		Hasher:   hasher,
 		DB:       db,
+
+		OIDC:           provider,
+		OIDCLanding:    cfg.OIDC.Landing,
+		SessionGroups:  cfg.Web.SessionGroups,
+		SecureCookies:  cfg.Web.SecureCookies,
+		MaxBodyBytes:   cfg.Web.MaxBodyBytes,
+		RequestTimeout: cfg.Web.RequestTimeout,
+		RateLimits: mid.RateLimitConfig{
+			Store:        limits,
+			ProxyHeader:  cfg.RateLimit.ProxyHeader,
+			APIKeyHeader: cfg.RateLimit.APIKeyHeader,
+		},
+		CORS:            cors,
+		CompressMinSize: cfg.Web.CompressMinSize,
+		CompressTypes:   cfg.Web.CompressTypes,
 	})
 	// Construct a server to service the requests against the mux.
 	api := http.Server{
@@ -209,6 +447,7 @@ func run(log *zap.SugaredLogger) error {
 		WriteTimeout: cfg.Web.WriteTimeout,
 		IdleTimeout:  cfg.Web.IdleTimeout,
 		ErrorLog:     zap.NewStdLog(log.Desugar()),
+		ConnContext:  web.ConnContext(cfg.Web.WriteTimeout),
 	}
 	// Make a channel to listen for errors coming from the listener. Use a
 	// buffered channel so the goroutine can exit if we don't collect this error.
@@ -246,6 +485,29 @@ func run(log *zap.SugaredLogger) error {
 	return nil
 }
 
+// purgeBuckets regularly deletes the buckets which weren't used for a while
+// so clients seen once don't stay in the database forever. A duration of zero
+// or less keeps the buckets.
+func purgeBuckets(ctx context.Context, log *zap.SugaredLogger, buckets bucket.Store, after time.Duration) {
+	if after <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(after)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := buckets.Purge(ctx, now.Add(-after)); err != nil {
+				log.Errorw("ratelimit", "status", "purging buckets", "ERROR", err)
+			}
+		}
+	}
+}
+
 // startTracing configure open telemetery to be used with zipkin.
 func startTracing(serviceName string, reporterURI string, probability float64) (*trace.TracerProvider, error) {
 
@@ -16,6 +16,7 @@ import (
 	"github.com/asishcse60/service/business/data/store/product"
 	"github.com/asishcse60/service/business/data/tests"
 	"github.com/asishcse60/service/business/sys/validate"
+	v1Web "github.com/asishcse60/service/business/web/v1"
 )
 
 // ProductTests holds methods for each product subtest. This type allows
@@ -49,6 +50,9 @@ func TestProducts(t *testing.T) {
 			Shutdown: shutdown,
 			Log:      test.Log,
 			Auth:     test.Auth,
+			Keys:     test.Keys,
+			Policy:   test.Policy,
+			Hasher:   test.Hasher,
 			DB:       test.DB,
 		}),
 		userToken: test.Token("admin@example.com", "gophers"),
@@ -83,29 +87,30 @@ func (pt *ProductTests) postProduct400(t *testing.T) {
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
 
 			// Inspect the response.
-			var got validate.ErrorResponse
+			var got v1Web.Problem
 			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
-				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to an error type : %v", tests.Failed, testID, err)
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem : %v", tests.Failed, testID, err)
 			}
-			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to an error type.", tests.Success, testID)
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem.", tests.Success, testID)
 
-			fields := validate.FieldErrors{
+			fields := []validate.FieldError{
 				{Field: "name", Error: "name is a required field"},
 				{Field: "cost", Error: "cost is a required field"},
 				{Field: "quantity", Error: "quantity must be 1 or greater"},
 			}
-			exp := validate.ErrorResponse{
-				Error:  "data validation error",
-				Fields: fields.Error(),
-			}
+			exp := v1Web.NewProblem(http.StatusBadRequest, "data validation error")
+			exp.Code = v1Web.CodeValidationFailed
+			exp.Errors = fields
 
 			// We can't rely on the order of the field errors so they have to be
-			// sorted. Tell the cmp package how to sort them.
+			// sorted. Tell the cmp package how to sort them. The instance and
+			// trace id change with every request.
 			sorter := cmpopts.SortSlices(func(a, b validate.FieldError) bool {
 				return a.Field < b.Field
 			})
+			ignore := cmpopts.IgnoreFields(v1Web.Problem{}, "Instance", "TraceID")
 
-			if diff := cmp.Diff(got, exp, sorter); diff != "" {
+			if diff := cmp.Diff(got, exp, sorter, ignore); diff != "" {
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
@@ -166,11 +171,19 @@ func (pt *ProductTests) getProduct400(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
 
-			got := w.Body.String()
-			exp := `{"error":"query: ID is not in its proper form"}`
-			if got != exp {
-				t.Logf("\t\tTest %d:\tGot : %v", testID, got)
-				t.Logf("\t\tTest %d:\tExp: %v", testID, exp)
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a problem document : %s", tests.Failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a problem document.", tests.Success, testID)
+
+			var got v1Web.Problem
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem.", tests.Success, testID)
+
+			if got.Code != v1Web.CodeInvalidID || !strings.Contains(got.Detail, "ID is not in its proper form") {
+				t.Logf("\t\tTest %d:\tGot : %+v", testID, got)
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
@@ -279,6 +292,7 @@ func (pt *ProductTests) crudProduct(t *testing.T) {
 	defer pt.deleteProduct204(t, p.ID)
 
 	pt.getProduct200(t, p.ID)
+	pt.getProductsExport200(t, p.ID)
 	pt.putProduct204(t, p.ID)
 }
 
@@ -395,6 +409,46 @@ func (pt *ProductTests) getProduct200(t *testing.T, id string) {
 	}
 }
 
+// getProductsExport200 validates the export streams the existing products.
+func (pt *ProductTests) getProductsExport200(t *testing.T, id string) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/products/export", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+pt.userToken)
+	r.Header.Set("Accept", "application/x-ndjson")
+	pt.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to validate exporting the products.")
+	{
+		testID := 0
+		t.Logf("\tTest : %d\tWhen asking for newline delimited JSON.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest : %d\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest : %d\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var found bool
+			dec := json.NewDecoder(w.Body)
+			for dec.More() {
+				var got product.Product
+				if err := dec.Decode(&got); err != nil {
+					t.Fatalf("\t%s\tTest : %d\tShould be able to unmarshal each line : %v", tests.Failed, testID, err)
+				}
+				if got.ID == id {
+					found = true
+				}
+			}
+			t.Logf("\t%s\tTest : %d\tShould be able to unmarshal each line.", tests.Success, testID)
+
+			if !found {
+				t.Fatalf("\t%s\tTest : %d\tShould include the new product %s.", tests.Failed, testID, id)
+			}
+			t.Logf("\t%s\tTest : %d\tShould include the new product %s.", tests.Success, testID, id)
+		}
+	}
+}
+
 // putProduct204 validates updating a product that does exist.
 func (pt *ProductTests) putProduct204(t *testing.T, id string) {
 	body := `{"name": "Graphic Novels", "cost": 100}`
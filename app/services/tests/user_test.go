@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"strings"
 	"testing"
@@ -17,6 +18,8 @@ import (
 	"github.com/asishcse60/service/business/data/tests"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/validate"
+	v1Web "github.com/asishcse60/service/business/web/v1"
+	"github.com/asishcse60/service/foundation/keystore"
 )
 
 // UserTests holds methods for each user subtest. This type allows passing
@@ -46,7 +49,12 @@ func TestUsers(t *testing.T) {
 			Shutdown: shutdown,
 			Log:      test.Log,
 			Auth:     test.Auth,
+			Keys:     test.Keys,
+			Policy:   test.Policy,
+			Hasher:   test.Hasher,
 			DB:       test.DB,
+
+			SessionGroups: []string{"users"},
 		}),
 		userToken:  test.Token("user@example.com", "gophers"),
 		adminToken: test.Token("admin@example.com", "gophers"),
@@ -54,6 +62,10 @@ func TestUsers(t *testing.T) {
 
 	t.Run("getToken404", tests.getToken404)
 	t.Run("getToken200", tests.getToken200)
+	t.Run("getJWKS200", tests.getJWKS200)
+	t.Run("getMe200", tests.getMe200)
+	t.Run("postIntrospect", tests.postIntrospect)
+	t.Run("session", tests.session)
 	t.Run("postUser400", tests.postUser400)
 	t.Run("postUser401", tests.postUser401)
 	t.Run("postUser403", tests.postUser403)
@@ -63,6 +75,7 @@ func TestUsers(t *testing.T) {
 	t.Run("deleteUserNotFound", tests.deleteUserNotFound)
 	t.Run("putUser404", tests.putUser404)
 	t.Run("crudUsers", tests.crudUser)
+	t.Run("deleteSessions", tests.deleteSessions)
 }
 
 // getToken401 ensures an unknown user can't generate a token.
@@ -116,6 +129,254 @@ func (ut *UserTests) getToken200(t *testing.T) {
 	}
 }
 
+// getJWKS200 validates the public keys needed to verify tokens are published.
+func (ut *UserTests) getJWKS200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to publish the keys used to verify tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen fetching the key set.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got keystore.JWKS
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response.", tests.Success, testID)
+
+			if len(got.Keys) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould get back a single key : %d", tests.Failed, testID, len(got.Keys))
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back a single key.", tests.Success, testID)
+		}
+	}
+}
+
+// getMe200 validates the caller can retrieve their own profile and the
+// permissions they hold.
+func (ut *UserTests) getMe200(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/v1/users/me", nil)
+	w := httptest.NewRecorder()
+
+	r.Header.Set("Authorization", "Bearer "+ut.userToken)
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to retrieve the profile of the caller.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using a user token.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got struct {
+				User        *user.User `json:"user"`
+				Roles       []string   `json:"roles"`
+				Permissions []string   `json:"permissions"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response.", tests.Success, testID)
+
+			if got.User == nil || got.User.Email != "user@example.com" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the profile of the caller : %+v", tests.Failed, testID, got.User)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the profile of the caller.", tests.Success, testID)
+
+			if len(got.Roles) != 1 || got.Roles[0] != auth.RoleUser {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the roles of the caller : %v", tests.Failed, testID, got.Roles)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the roles of the caller.", tests.Success, testID)
+
+			if len(got.Permissions) == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the permissions of the caller.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the permissions of the caller.", tests.Success, testID)
+		}
+	}
+}
+
+// postIntrospect validates trusted callers can check whether a token is
+// active.
+func (ut *UserTests) postIntrospect(t *testing.T) {
+	introspect := func(bearer string, token string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {token}}
+		r := httptest.NewRequest(http.MethodPost, "/v1/auth/introspect", strings.NewReader(form.Encode()))
+		w := httptest.NewRecorder()
+
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+bearer)
+		ut.app.ServeHTTP(w, r)
+		return w
+	}
+
+	var got struct {
+		Active  bool   `json:"active"`
+		Subject string `json:"sub"`
+	}
+
+	t.Log("Given the need to introspect tokens.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen introspecting a valid token as an admin.", testID)
+		{
+			w := introspect(ut.adminToken, ut.userToken)
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if !got.Active || got.Subject == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould report the token as active : %+v", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the token as active.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen introspecting an invalid token as an admin.", testID)
+		{
+			w := introspect(ut.adminToken, "not-a-token")
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			got.Active = true
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			if got.Active {
+				t.Fatalf("\t%s\tTest %d:\tShould report the token as inactive.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the token as inactive.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen introspecting a token as a user.", testID)
+		{
+			w := introspect(ut.userToken, ut.adminToken)
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 403 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 403 for the response.", tests.Success, testID)
+		}
+	}
+}
+
+// session validates browser clients can use a session cookie protected
+// against cross site request forgery.
+func (ut *UserTests) session(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/v1/users/session", nil)
+	w := httptest.NewRecorder()
+
+	r.SetBasicAuth("user@example.com", "gophers")
+	ut.app.ServeHTTP(w, r)
+
+	t.Log("Given the need to authenticate browser clients with a session.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen logging in with valid credentials.", testID)
+		{
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", tests.Failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", tests.Success, testID)
+
+			var got struct {
+				CSRFToken string `json:"csrf_token"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response.", tests.Success, testID)
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 2 || !cookies[0].HttpOnly || cookies[1].Value != got.CSRFToken {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the session and csrf cookies : %v", tests.Failed, testID, cookies)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive the session and csrf cookies.", tests.Success, testID)
+
+			send := func(method string, path string, csrf string) int {
+				r := httptest.NewRequest(method, path, nil)
+				w := httptest.NewRecorder()
+
+				for _, c := range cookies {
+					r.AddCookie(c)
+				}
+				if csrf != "" {
+					r.Header.Set(auth.CSRFHeader, csrf)
+				}
+				ut.app.ServeHTTP(w, r)
+				return w.Code
+			}
+
+			if code := send(http.MethodGet, "/v1/users/me", ""); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read with the session cookie : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to read with the session cookie.", tests.Success, testID)
+
+			if code := send(http.MethodDelete, "/v1/users/session", ""); code != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould require the csrf header on unsafe methods : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require the csrf header on unsafe methods.", tests.Success, testID)
+
+			if code := send(http.MethodDelete, "/v1/users/session", got.CSRFToken); code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to logout with the csrf header : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to logout with the csrf header.", tests.Success, testID)
+
+			if code := send(http.MethodGet, "/v1/users/me", ""); code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould not revoke the other tokens of the user : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not revoke the other tokens of the user.", tests.Success, testID)
+		}
+	}
+}
+
+// deleteSessions validates a user can log out everywhere, revoking every
+// token issued to the user. It runs last since it revokes the user token.
+func (ut *UserTests) deleteSessions(t *testing.T) {
+	send := func(method string, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+
+		r.Header.Set("Authorization", "Bearer "+ut.userToken)
+		ut.app.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Log("Given the need to log a user out everywhere.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen revoking the sessions of the user.", testID)
+		{
+			if code := send(http.MethodDelete, "/v1/users/sessions"); code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 for the response : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204 for the response.", tests.Success, testID)
+
+			if code := send(http.MethodGet, "/v1/users/me"); code != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the revoked token : %v", tests.Failed, testID, code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the revoked token.", tests.Success, testID)
+		}
+	}
+}
+
 // postUser400 validates a user can't be created with the endpoint
 // unless a valid user document is submitted.
 func (ut *UserTests) postUser400(t *testing.T) {
@@ -140,30 +401,31 @@ func (ut *UserTests) postUser400(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
 
-			var got validate.ErrorResponse
+			var got v1Web.Problem
 			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
-				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to an error type : %v", tests.Failed, testID, err)
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem : %v", tests.Failed, testID, err)
 			}
-			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to an error type.", tests.Success, testID)
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem.", tests.Success, testID)
 
-			fields := validate.FieldErrors{
+			fields := []validate.FieldError{
 				{Field: "name", Error: "name is a required field"},
 				{Field: "email", Error: "email is a required field"},
 				{Field: "roles", Error: "roles is a required field"},
 				{Field: "password", Error: "password is a required field"},
 			}
-			exp := validate.ErrorResponse{
-				Error:  "data validation error",
-				Fields: fields.Error(),
-			}
+			exp := v1Web.NewProblem(http.StatusBadRequest, "data validation error")
+			exp.Code = v1Web.CodeValidationFailed
+			exp.Errors = fields
 
 			// We can't rely on the order of the field errors so they have to be
-			// sorted. Tell the cmp package how to sort them.
+			// sorted. Tell the cmp package how to sort them. The instance and
+			// trace id change with every request.
 			sorter := cmpopts.SortSlices(func(a, b validate.FieldError) bool {
 				return a.Field < b.Field
 			})
+			ignore := cmpopts.IgnoreFields(v1Web.Problem{}, "Instance", "TraceID")
 
-			if diff := cmp.Diff(got, exp, sorter); diff != "" {
+			if diff := cmp.Diff(got, exp, sorter, ignore); diff != "" {
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
@@ -245,11 +507,19 @@ func (ut *UserTests) getUser400(t *testing.T) {
 			}
 			t.Logf("\t%s\tTest %d:\tShould receive a status code of 400 for the response.", tests.Success, testID)
 
-			got := w.Body.String()
-			exp := `{"error":"query: ID is not in its proper form"}`
-			if got != exp {
-				t.Logf("\t\tTest %d:\tGot : %v", testID, got)
-				t.Logf("\t\tTest %d:\tExp: %v", testID, exp)
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a problem document : %s", tests.Failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a problem document.", tests.Success, testID)
+
+			var got v1Web.Problem
+			if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem : %v", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to unmarshal the response to a problem.", tests.Success, testID)
+
+			if got.Code != v1Web.CodeInvalidID || !strings.Contains(got.Detail, "ID is not in its proper form") {
+				t.Logf("\t\tTest %d:\tGot : %+v", testID, got)
 				t.Fatalf("\t%s\tTest %d:\tShould get the expected result.", tests.Failed, testID)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get the expected result.", tests.Success, testID)
@@ -1,21 +1,75 @@
 package commands
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
 	"os"
+
+	"github.com/asishcse60/service/foundation/keystore"
 )
 
-// GenKey creates an x509 private/public key for auth tokens.
-func GenKey() error {
+// GenKey creates an x509 private/public key for auth tokens. The key type
+// can be rsa, ecdsa or ed25519 and decides the algorithm used to sign the
+// tokens. An empty key type generates an rsa key. When a passphrase is
+// provided the private key is stored as encrypted PKCS#8.
+func GenKey(keyType string, passphrase []byte) error {
 
-	// Generate a new private key.
-	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		return err
+	// Generate a new private key and construct a PEM block for it.
+	var privateKey crypto.Signer
+	var privateBlock pem.Block
+	switch keyType {
+	case "", "rsa":
+		pk, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		privateKey = pk
+		privateBlock = pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(pk),
+		}
+
+	case "ecdsa", "ed25519":
+		if keyType == "ecdsa" {
+			pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				return err
+			}
+			privateKey = pk
+		} else {
+			_, pk, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				return err
+			}
+			privateKey = pk
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return fmt.Errorf("marshaling private key: %w", err)
+		}
+		privateBlock = pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: der,
+		}
+
+	default:
+		return fmt.Errorf("unsupported key type %q, expecting rsa, ecdsa or ed25519", keyType)
+	}
+
+	// Replace the block with an encrypted one when a passphrase is provided.
+	if len(passphrase) > 0 {
+		block, err := keystore.MarshalEncryptedPrivateKey(privateKey, passphrase)
+		if err != nil {
+			return err
+		}
+		privateBlock = *block
 	}
 
 	// Create a file for the private key information in PEM form.
@@ -25,19 +79,13 @@ func GenKey() error {
 	}
 	defer privateFile.Close()
 
-	// Construct a PEM block for the private key.
-	privateBlock := pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-
 	// Write the private key to the private key file.
 	if err := pem.Encode(privateFile, &privateBlock); err != nil {
 		return fmt.Errorf("encoding to private file: %w", err)
 	}
 
 	// Marshal the public key from the private key to PKIX.
-	asn1Bytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	asn1Bytes, err := x509.MarshalPKIXPublicKey(privateKey.Public())
 	if err != nil {
 		return fmt.Errorf("marshaling public key: %w", err)
 	}
@@ -51,9 +99,12 @@ func GenKey() error {
 
 	// Construct a PEM block for the public key.
 	publicBlock := pem.Block{
-		Type:  "RSA PUBLIC KEY",
+		Type:  "PUBLIC KEY",
 		Bytes: asn1Bytes,
 	}
+	if _, ok := privateKey.(*rsa.PrivateKey); ok {
+		publicBlock.Type = "RSA PUBLIC KEY"
+	}
 
 	// Write the public key to the private key file.
 	if err := pem.Encode(publicFile, &publicBlock); err != nil {
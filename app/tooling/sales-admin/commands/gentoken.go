@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -12,12 +13,15 @@ import (
 	"github.com/asishcse60/service/business/data/store/user"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 	"github.com/asishcse60/service/foundation/keystore"
 )
 
-func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid string) error {
+// GenToken generates a JWT for the specified user. The token can be
+// restricted to a space delimited list of permissions the user's roles allow.
+func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid string, scope string) error {
 	if userID == "" || kid == "" {
-		fmt.Println("help: gentoken <user_id> <kid>")
+		fmt.Println("help: gentoken <user_id> <kid> [scope]")
 		return ErrHelp
 	}
 
@@ -30,7 +34,12 @@ func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid st
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	user := user.NewStore(log, db)
+	policy, err := loadPolicy(ctx, log, db)
+	if err != nil {
+		return err
+	}
+
+	user := user.NewStore(log, db, policy, password.Default(password.DefaultParams))
 
 	// The call to retrieve a user requires an Admin role by the caller.
 	claims := auth.Claims{
@@ -55,7 +64,7 @@ func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid st
 
 	// Init the auth package.
 	activeKID := "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
-	a, err := auth.New(activeKID, ks)
+	a, err := auth.New(activeKID, ks, auth.WithIssuer("service project"), auth.WithAudience("sales-api"))
 	if err != nil {
 		return fmt.Errorf("constructing auth: %w", err)
 	}
@@ -65,6 +74,8 @@ func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid st
 	// case, we only care about defining the subject and the user in question and
 	// the roles they have on the database. This token will expire in a year.
 	//
+	// The issuer and audience are stamped by the auth package.
+	//
 	// iss (issuer): Issuer of the JWT
 	// sub (subject): Subject of the JWT (the user)
 	// aud (audience): Recipient for which the JWT is intended
@@ -75,11 +86,18 @@ func GenToken(log *zap.SugaredLogger, cfg database.Config, userID string, kid st
 	claims = auth.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   usr.ID,
-			Issuer:    "service project",
 			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(8760 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		},
-		Roles: usr.Roles,
+		Roles:   usr.Roles,
+		Version: usr.TokenVersion,
+	}
+
+	// Restrict the token to the requested scope. The scope can only contain
+	// permissions granted by the roles of the user.
+	claims.Scope, err = policy.Scope(usr.Roles, strings.Fields(scope))
+	if err != nil {
+		return fmt.Errorf("scoping token: %w", err)
 	}
 
 	// This will generate a JWT with the claims embedded in them. The database
@@ -0,0 +1,23 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/core/role"
+	"github.com/asishcse60/service/business/sys/auth"
+)
+
+// loadPolicy constructs the policy the service enforces, made of the roles
+// stored in the database or the built-in roles when none are stored.
+func loadPolicy(ctx context.Context, log *zap.SugaredLogger, db *sqlx.DB) (*auth.Policy, error) {
+	policy := auth.DefaultPolicy()
+	if err := role.NewCore(log, db, policy).LoadPolicy(ctx); err != nil {
+		return nil, fmt.Errorf("loading policy: %w", err)
+	}
+
+	return policy, nil
+}
@@ -10,11 +10,12 @@ import (
 	"github.com/asishcse60/service/business/data/store/user"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 )
 
 // UserAdd adds new users into the database.
-func UserAdd(log *zap.SugaredLogger, cfg database.Config, name, email, password string) error {
-	if name == "" || email == "" || password == "" {
+func UserAdd(log *zap.SugaredLogger, cfg database.Config, name, email, pass string) error {
+	if name == "" || email == "" || pass == "" {
 		fmt.Println("help: useradd <name> <email> <password>")
 		return ErrHelp
 	}
@@ -28,17 +29,26 @@ func UserAdd(log *zap.SugaredLogger, cfg database.Config, name, email, password
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	store := user.NewStore(log, db)
+	policy, err := loadPolicy(ctx, log, db)
+	if err != nil {
+		return err
+	}
+
+	store := user.NewStore(log, db, policy, password.Default(password.DefaultParams))
 
 	nu := user.NewUser{
 		Name:            name,
 		Email:           email,
-		Password:        password,
-		PasswordConfirm: password,
+		Password:        pass,
+		PasswordConfirm: pass,
 		Roles:           []string{auth.RoleAdmin, auth.RoleUser},
 	}
 
-	usr, err := store.Create(ctx, nu, time.Now())
+	// The tool is run by an operator with access to the database, it acts
+	// with the permissions of an admin.
+	admin := auth.Claims{Roles: []string{auth.RoleAdmin}}
+
+	usr, err := store.Create(ctx, admin, nu, time.Now())
 	if err != nil {
 		return fmt.Errorf("create user: %w", err)
 	}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/asishcse60/service/business/data/store/user"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 )
 
 // Users retrieves all users from the database.
@@ -35,7 +36,12 @@ func Users(log *zap.SugaredLogger, cfg database.Config, pageNumber string, rowsP
 		return fmt.Errorf("converting rows per page: %w", err)
 	}
 
-	store := user.NewStore(log, db)
+	policy, err := loadPolicy(ctx, log, db)
+	if err != nil {
+		return err
+	}
+
+	store := user.NewStore(log, db, policy, password.Default(password.DefaultParams))
 
 	users, err := store.Query(ctx, page, rows)
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 
 	"github.com/asishcse60/service/app/tooling/sales-admin/commands"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/foundation/keystore"
 	"github.com/asishcse60/service/foundation/logger"
 )
 
@@ -50,6 +51,10 @@ func run(log *zap.SugaredLogger) error {
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:true"`
 		}
+		Keys struct {
+			Passphrase     string `conf:"mask,help:passphrase used by genkey --encrypt"`
+			PassphraseFile string `conf:"help:secrets file holding the passphrase used by genkey --encrypt"`
+		}
 	}{
 		Version: conf.Version{
 			SVN: build,
@@ -83,12 +88,12 @@ func run(log *zap.SugaredLogger) error {
 		Name:       cfg.DB.Name,
 		DisableTLS: cfg.DB.DisableTLS,
 	}
-	return processCommands(cfg.Args, log, dbConfig)
+	return processCommands(cfg.Args, log, dbConfig, cfg.Keys.Passphrase, cfg.Keys.PassphraseFile)
 }
 
 // processCommands handles the execution of the commands specified on
 // the command line.
-func processCommands(args conf.Args, log *zap.SugaredLogger, dbConfig database.Config) error {
+func processCommands(args conf.Args, log *zap.SugaredLogger, dbConfig database.Config, passphrase string, passphraseFile string) error {
 	switch args.Num(0) {
 	case "migrate":
 		if err := commands.Migrate(dbConfig); err != nil {
@@ -116,14 +121,35 @@ func processCommands(args conf.Args, log *zap.SugaredLogger, dbConfig database.C
 		}
 
 	case "genkey":
-		if err := commands.GenKey(); err != nil {
+		var keyType string
+		var encrypt bool
+		for _, arg := range args[1:] {
+			switch arg {
+			case "--encrypt":
+				encrypt = true
+			default:
+				keyType = arg
+			}
+		}
+
+		// Encrypting the key requires a passphrase.
+		var pass []byte
+		if encrypt {
+			var err error
+			if pass, err = keystore.ReadPassphrase(passphrase, passphraseFile); err != nil {
+				return fmt.Errorf("reading passphrase: %w", err)
+			}
+		}
+
+		if err := commands.GenKey(keyType, pass); err != nil {
 			return fmt.Errorf("key generation: %w", err)
 		}
 
 	case "gentoken":
 		userID := args.Num(1)
 		kid := args.Num(2)
-		if err := commands.GenToken(log, dbConfig, userID, kid); err != nil {
+		scope := args.Num(3)
+		if err := commands.GenToken(log, dbConfig, userID, kid, scope); err != nil {
 			return fmt.Errorf("generating token: %w", err)
 		}
 
@@ -132,7 +158,7 @@ func processCommands(args conf.Args, log *zap.SugaredLogger, dbConfig database.C
 		fmt.Println("seed: add data to the database")
 		fmt.Println("useradd: add a new user to the database")
 		fmt.Println("users: get a list of users from the database")
-		fmt.Println("genkey: generate a set of private/public key files")
+		fmt.Println("genkey: generate a set of private/public key files of type rsa, ecdsa or ed25519, use --encrypt to protect the private key with a passphrase")
 		fmt.Println("gentoken: generate a JWT for a user with claims")
 		fmt.Println("provide a command to get more help.")
 		return commands.ErrHelp
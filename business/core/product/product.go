@@ -22,10 +22,10 @@ type Core struct {
 }
 
 // NewCore constructs a core for product api access.
-func NewCore(log *zap.SugaredLogger, db *sqlx.DB) Core {
+func NewCore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy) Core {
 	return Core{
 		log:     log,
-		product: product.NewStore(log, db),
+		product: product.NewStore(log, db, policy),
 	}
 }
 
@@ -89,6 +89,22 @@ func (c Core) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]pro
 	return products, nil
 }
 
+// Export gets all Products from the database one at a time. The caller must
+// close the returned iterator.
+func (c Core) Export(ctx context.Context) (*product.Iterator, error) {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	it, err := c.product.Export(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("export: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return it, nil
+}
+
 // QueryByID finds the product identified by a given ID.
 func (c Core) QueryByID(ctx context.Context, productID string) (product.Product, error) {
 
@@ -0,0 +1,152 @@
+// Package role provides the core business API for managing roles. Every
+// change to the set of roles is applied to the policy used to authorize
+// requests so the change takes effect immediately on the instance serving
+// it. Other instances pick the change up the next time they poll the roles.
+package role
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/data/store/role"
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/database"
+)
+
+// Core manages the set of API's for role access.
+type Core struct {
+	log    *zap.SugaredLogger
+	role   role.Store
+	policy *auth.Policy
+}
+
+// NewCore constructs a core for role api access.
+func NewCore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy) Core {
+	return Core{
+		log:    log,
+		role:   role.NewStore(log, db, policy),
+		policy: policy,
+	}
+}
+
+// Create inserts a new role into the database.
+func (c Core) Create(ctx context.Context, claims auth.Claims, nr role.NewRole, now time.Time) (role.Role, error) {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	rol, err := c.role.Create(ctx, claims, nr, now)
+	if err != nil {
+		return role.Role{}, fmt.Errorf("create: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	if err := c.LoadPolicy(ctx); err != nil {
+		return role.Role{}, fmt.Errorf("create: %w", err)
+	}
+
+	return rol, nil
+}
+
+// Update replaces the permissions of a role in the database.
+func (c Core) Update(ctx context.Context, claims auth.Claims, name string, ur role.UpdateRole, now time.Time) error {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	if err := c.role.Update(ctx, claims, name, ur, now); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	if err := c.LoadPolicy(ctx); err != nil {
+		return fmt.Errorf("update: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes a role from the database.
+func (c Core) Delete(ctx context.Context, claims auth.Claims, name string) error {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	if err := c.role.Delete(ctx, claims, name); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	if err := c.LoadPolicy(ctx); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	return nil
+}
+
+// Query retrieves the list of roles from the database.
+func (c Core) Query(ctx context.Context) ([]role.Role, error) {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	roles, err := c.role.Query(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return roles, nil
+}
+
+// LoadPolicy replaces the roles held by the policy with the roles stored
+// in the database. If no roles are stored the policy is left untouched.
+func (c Core) LoadPolicy(ctx context.Context) error {
+	roles, err := c.role.Query(ctx)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return nil
+		}
+		return fmt.Errorf("loading roles: %w", err)
+	}
+	if len(roles) == 0 {
+		return nil
+	}
+
+	m := make(map[string][]string, len(roles))
+	for _, rol := range roles {
+		m[rol.Name] = rol.Permissions
+	}
+	c.policy.Load(m)
+
+	return nil
+}
+
+// PollPolicy reloads the roles into the policy on the specified interval
+// until the context is cancelled, so changes made through another instance
+// of the service are applied. Errors are reported to the provided function
+// and do not stop the polling. An interval of zero or less disables polling.
+func (c Core) PollPolicy(ctx context.Context, interval time.Duration, errFn func(error)) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.LoadPolicy(ctx); err != nil {
+				errFn(err)
+			}
+		}
+	}
+}
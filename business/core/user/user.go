@@ -13,28 +13,32 @@ import (
 
 	"github.com/asishcse60/service/business/data/store/user"
 	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/password"
+	"github.com/asishcse60/service/foundation/web"
 )
 
 // Core manages the set of API's for user access.
 type Core struct {
-	log  *zap.SugaredLogger
-	user user.Store
+	log    *zap.SugaredLogger
+	user   user.Store
+	policy *auth.Policy
 }
 
 // NewCore constructs a core for user api access.
-func NewCore(log *zap.SugaredLogger, db *sqlx.DB) Core {
+func NewCore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy, hasher password.Hasher) Core {
 	return Core{
-		log:  log,
-		user: user.NewStore(log, db),
+		log:    log,
+		user:   user.NewStore(log, db, policy, hasher),
+		policy: policy,
 	}
 }
 
 // Create inserts a new user into the database.
-func (c Core) Create(ctx context.Context, nu user.NewUser, now time.Time) (user.User, error) {
+func (c Core) Create(ctx context.Context, claims auth.Claims, nu user.NewUser, now time.Time) (user.User, error) {
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
-	usr, err := c.user.Create(ctx, nu, now)
+	usr, err := c.user.Create(ctx, claims, nu, now)
 	if err != nil {
 		return user.User{}, fmt.Errorf("create: %w", err)
 	}
@@ -58,6 +62,34 @@ func (c Core) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	return nil
 }
 
+// UpdateStatus suspends or reactivates a user in the database.
+func (c Core) UpdateStatus(ctx context.Context, claims auth.Claims, userID string, us user.UpdateStatus, now time.Time) error {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	if err := c.user.UpdateStatus(ctx, claims, userID, us, now); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return nil
+}
+
+// Revoke invalidates every token issued to the subject of the claims.
+func (c Core) Revoke(ctx context.Context, claims auth.Claims, now time.Time) error {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	if err := c.user.Revoke(ctx, claims, now); err != nil {
+		return fmt.Errorf("revoke: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return nil
+}
+
 // Delete removes a user from the database.
 func (c Core) Delete(ctx context.Context, claims auth.Claims, userID string) error {
 
@@ -119,8 +151,10 @@ func (c Core) QueryByEmail(ctx context.Context, claims auth.Claims, email string
 
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns a Claims User representing this user. The claims can be
-// used to generate a token for future authentication.
-func (c Core) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
+// used to generate a token for future authentication. When scopes are
+// requested the claims are restricted to them, as long as the roles of the
+// user allow it.
+func (c Core) Authenticate(ctx context.Context, now time.Time, email, password string, scopes ...string) (auth.Claims, error) {
 
 	// PERFORM PRE BUSINESS OPERATIONS
 
@@ -131,5 +165,56 @@ func (c Core) Authenticate(ctx context.Context, now time.Time, email, password s
 
 	// PERFORM POST BUSINESS OPERATIONS
 
+	claims.Scope, err = c.policy.Scope(claims.Roles, scopes)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("scope: %w", err)
+	}
+
 	return claims, nil
 }
+
+// AuthenticateIdentity finds or provisions the user linked to an identity
+// asserted by an external provider. On success it returns the claims
+// representing the user.
+func (c Core) AuthenticateIdentity(ctx context.Context, now time.Time, ni user.NewIdentity) (auth.Claims, error) {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	claims, err := c.user.AuthenticateIdentity(ctx, now, ni)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("query: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	return claims, nil
+}
+
+// Impersonate returns claims that allow an admin to act as the specified
+// user. Every impersonation is recorded in the audit log.
+func (c Core) Impersonate(ctx context.Context, claims auth.Claims, userID string, now time.Time) (auth.Claims, error) {
+
+	// PERFORM PRE BUSINESS OPERATIONS
+
+	imp, err := c.user.Impersonate(ctx, claims, userID, now)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("impersonate: %w", err)
+	}
+
+	// PERFORM POST BUSINESS OPERATIONS
+
+	c.log.Infow("audit", "traceid", web.GetTraceID(ctx), "action", "impersonate", "actor", claims.Subject,
+		"subject", imp.Subject, "expires", imp.ExpiresAt.Time)
+
+	return imp, nil
+}
+
+// CheckClaims verifies the claims of a validated token are still current for
+// the user. It implements the auth.ClaimsChecker interface.
+func (c Core) CheckClaims(ctx context.Context, claims auth.Claims) error {
+	if err := c.user.CheckClaims(ctx, claims); err != nil {
+		return fmt.Errorf("check claims: %w", err)
+	}
+
+	return nil
+}
@@ -41,3 +41,58 @@ CREATE TABLE sales (
 	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE,
 	FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
 );
+
+-- Version: 1.4
+-- Description: Create table roles
+CREATE TABLE roles (
+	name         TEXT,
+	permissions  TEXT[],
+	date_created TIMESTAMP,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (name)
+);
+
+INSERT INTO roles (name, permissions, date_created, date_updated) VALUES
+('ADMIN', '{user:create,user:list,user:read:any,user:read:own,user:update:any,user:update:own,user:delete:any,user:delete:own,product:create,product:read,product:update:any,product:update:own,product:delete,role:manage}', now(), now()),
+('USER', '{user:read:own,product:create,product:read,product:update:own}', now(), now());
+
+-- Version: 1.5
+-- Description: Add account status and token version to users
+ALTER TABLE users
+	ADD COLUMN status        TEXT DEFAULT 'active',
+	ADD COLUMN token_version INT  DEFAULT 0;
+
+-- Version: 1.6
+-- Description: Grant key management to the ADMIN role
+UPDATE roles SET permissions = array_append(permissions, 'key:manage') WHERE name = 'ADMIN';
+
+-- Version: 1.7
+-- Description: Grant token introspection to the ADMIN role
+UPDATE roles SET permissions = array_append(permissions, 'token:introspect') WHERE name = 'ADMIN';
+
+-- Version: 1.8
+-- Description: Grant impersonation to the ADMIN role
+UPDATE roles SET permissions = array_append(permissions, 'user:impersonate') WHERE name = 'ADMIN';
+
+-- Version: 1.9
+-- Description: Create table user_identities
+CREATE TABLE user_identities (
+	issuer       TEXT,
+	subject      TEXT,
+	user_id      UUID,
+	date_created TIMESTAMP,
+
+	PRIMARY KEY (issuer, subject),
+	FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE
+);
+
+-- Version: 2.0
+-- Description: Create table rate_buckets
+CREATE TABLE rate_buckets (
+	key          TEXT,
+	tokens       DOUBLE PRECISION,
+	date_updated TIMESTAMP,
+
+	PRIMARY KEY (key)
+);
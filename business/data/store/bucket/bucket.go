@@ -0,0 +1,87 @@
+// Package bucket contains the token buckets used to rate limit clients
+// across every instance of the service.
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+)
+
+// Store manages the set of API's for bucket access. It implements the
+// ratelimit.Store interface.
+type Store struct {
+	log *zap.SugaredLogger
+	db  *sqlx.DB
+}
+
+// NewStore constructs a bucket store for api access. The queries run for
+// every rate limited request so they aren't logged, their errors are
+// returned to the caller.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB) Store {
+	return Store{
+		log: log.Desugar().WithOptions(zap.IncreaseLevel(zap.WarnLevel)).Sugar(),
+		db:  db,
+	}
+}
+
+// Take takes a token from the bucket identified by the key. The bucket is
+// locked while it is updated so concurrent requests served by other
+// instances wait for their turn.
+func (s Store) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	var res ratelimit.Result
+
+	tran := func(tx sqlx.ExtContext) error {
+		bkt := Bucket{
+			Key:         key,
+			Tokens:      float64(limit.Burst),
+			DateUpdated: now,
+		}
+		if err := database.NamedExecContext(ctx, s.log, tx, CreateBucketQuery, bkt); err != nil {
+			return fmt.Errorf("inserting bucket: %w", err)
+		}
+
+		if err := database.NamedQueryStruct(ctx, s.log, tx, LockBucketQuery, bkt, &bkt); err != nil {
+			return fmt.Errorf("selecting bucket key[%s]: %w", key, err)
+		}
+
+		var b ratelimit.Bucket
+		b, res = ratelimit.Take(ratelimit.Bucket{Tokens: bkt.Tokens, Updated: bkt.DateUpdated}, limit, now)
+
+		bkt.Tokens = b.Tokens
+		bkt.DateUpdated = b.Updated
+		if err := database.NamedExecContext(ctx, s.log, tx, UpdateBucketQuery, bkt); err != nil {
+			return fmt.Errorf("updating bucket key[%s]: %w", key, err)
+		}
+
+		return nil
+	}
+
+	if err := database.WithinTran(ctx, s.log, s.db, tran); err != nil {
+		return ratelimit.Result{}, fmt.Errorf("tran: %w", err)
+	}
+
+	return res, nil
+}
+
+// Purge removes the buckets which weren't used since the given time. Those
+// are full again for any limit refilling within that time.
+func (s Store) Purge(ctx context.Context, before time.Time) error {
+	data := struct {
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		DateUpdated: before,
+	}
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, PurgeBucketQuery, data); err != nil {
+		return fmt.Errorf("deleting buckets: %w", err)
+	}
+
+	return nil
+}
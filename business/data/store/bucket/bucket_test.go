@@ -0,0 +1,85 @@
+package bucket_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asishcse60/service/business/data/store/bucket"
+	"github.com/asishcse60/service/business/data/tests"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+)
+
+var dbc = tests.DBContainer{
+	Image: "postgres:14-alpine",
+	Port:  "5432",
+	Args:  []string{"-e", "POSTGRES_PASSWORD=postgres"},
+}
+
+func TestBucket(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t, dbc)
+	t.Cleanup(teardown)
+
+	store := bucket.NewStore(log, db)
+
+	t.Log("Given the need to work with rate limit buckets.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen taking tokens from a bucket.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+			limit := ratelimit.Limit{Rate: 1, Per: time.Second, Burst: 2}
+
+			for i := 0; i < limit.Burst; i++ {
+				res, err := store.Take(ctx, "test:client", limit, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to take a token : %s.", tests.Failed, testID, err)
+				}
+				if !res.Allowed {
+					t.Fatalf("\t%s\tTest %d:\tShould be allowed while the bucket has tokens.", tests.Failed, testID)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be allowed while the bucket has tokens.", tests.Success, testID)
+
+			res, err := store.Take(ctx, "test:client", limit, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take a token : %s.", tests.Failed, testID, err)
+			}
+			if res.Allowed || res.RetryAfter != time.Second {
+				t.Fatalf("\t%s\tTest %d:\tShould be rejected for a second once the bucket is empty : %+v.", tests.Failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be rejected for a second once the bucket is empty.", tests.Success, testID)
+
+			res, err = store.Take(ctx, "test:other", limit, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take a token : %s.", tests.Failed, testID, err)
+			}
+			if !res.Allowed {
+				t.Fatalf("\t%s\tTest %d:\tShould keep a bucket for each key.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep a bucket for each key.", tests.Success, testID)
+
+			res, err = store.Take(ctx, "test:client", limit, now.Add(time.Second))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take a token : %s.", tests.Failed, testID, err)
+			}
+			if !res.Allowed {
+				t.Fatalf("\t%s\tTest %d:\tShould be allowed once the bucket is refilled.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be allowed once the bucket is refilled.", tests.Success, testID)
+
+			if err := store.Purge(ctx, now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to purge buckets : %s.", tests.Failed, testID, err)
+			}
+			res, err = store.Take(ctx, "test:client", limit, now.Add(time.Second))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to take a token : %s.", tests.Failed, testID, err)
+			}
+			if res.Remaining != limit.Burst-1 {
+				t.Fatalf("\t%s\tTest %d:\tShould start with a full bucket once purged : %+v.", tests.Failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould start with a full bucket once purged.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package bucket
+
+import "time"
+
+// Bucket represents the token bucket of a client for a rate limit.
+type Bucket struct {
+	Key         string    `db:"key"`
+	Tokens      float64   `db:"tokens"`
+	DateUpdated time.Time `db:"date_updated"`
+}
@@ -0,0 +1,41 @@
+package bucket
+
+const (
+	// CreateBucketQuery - declare bucket create query. A bucket which already
+	// exists is left as is.
+	CreateBucketQuery = `
+	INSERT INTO rate_buckets
+		(key, tokens, date_updated)
+	VALUES
+		(:key, :tokens, :date_updated)
+	ON CONFLICT (key) DO NOTHING`
+
+	// LockBucketQuery - declare bucket query locking the bucket until the
+	// transaction ends.
+	LockBucketQuery = `
+	SELECT
+		*
+	FROM
+		rate_buckets
+	WHERE
+		key = :key
+	FOR UPDATE`
+
+	// UpdateBucketQuery - declare bucket update query.
+	UpdateBucketQuery = `
+	UPDATE
+		rate_buckets
+	SET
+		"tokens" = :tokens,
+		"date_updated" = :date_updated
+	WHERE
+		key = :key`
+
+	// PurgeBucketQuery - declare query deleting buckets which weren't used
+	// since a given time.
+	PurgeBucketQuery = `
+	DELETE FROM
+		rate_buckets
+	WHERE
+		date_updated < :date_updated`
+)
@@ -1,6 +1,10 @@
 package product
 
-import "time"
+import (
+	"time"
+
+	"github.com/asishcse60/service/business/sys/validate"
+)
 
 // Product represents an individual product.
 type Product struct {
@@ -23,6 +27,11 @@ type NewProduct struct {
 	UserID   string `db:"user_id" json:"user_id"`
 }
 
+// Validate checks the fields required to add a Product.
+func (np NewProduct) Validate() error {
+	return validate.Check(np)
+}
+
 // UpdateProduct defines what information may be provided to modify an
 // existing Product. All fields are optional so clients can send just the
 // fields they want changed. It uses pointer fields so we can differentiate
@@ -34,3 +43,8 @@ type UpdateProduct struct {
 	Cost     *int    `json:"cost" validate:"omitempty,gte=0"`
 	Quantity *int    `json:"quantity" validate:"omitempty,gte=1"`
 }
+
+// Validate checks the fields provided to modify a Product.
+func (up UpdateProduct) Validate() error {
+	return validate.Check(up)
+}
@@ -6,6 +6,7 @@ package product
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -18,15 +19,18 @@ import (
 
 // Store manages the set of API's for product access.
 type Store struct {
-	log *zap.SugaredLogger
-	db  *sqlx.DB
+	log    *zap.SugaredLogger
+	db     *sqlx.DB
+	policy *auth.Policy
 }
 
-// NewStore constructs a product store for api access.
-func NewStore(log *zap.SugaredLogger, db *sqlx.DB) Store {
+// NewStore constructs a product store for api access. The policy is used to
+// decide if the claims of a caller allow changes to a product.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy) Store {
 	return Store{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
 	}
 }
 
@@ -69,8 +73,8 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, productID string,
 		return fmt.Errorf("updating product productID[%s]: %w", productID, err)
 	}
 
-	// If you are not an admin and looking to retrieve someone elses product.
-	if !claims.Authorized(auth.RoleAdmin) && prd.UserID != claims.Subject {
+	// If you are not allowed to update any product and this is not yours.
+	if !s.policy.PermittedOwner(claims, prd.UserID, auth.PermProductUpdateAny, auth.PermProductUpdateOwn) {
 		return database.ErrForbidden
 	}
 
@@ -98,8 +102,8 @@ func (s Store) Delete(ctx context.Context, claims auth.Claims, productID string)
 		return database.ErrInvalidID
 	}
 
-	// If you are not an admin.
-	if !claims.Authorized(auth.RoleAdmin) {
+	// If you are not allowed to delete products.
+	if !s.policy.Permitted(claims, auth.PermProductDelete) {
 		return database.ErrForbidden
 	}
 
@@ -137,6 +141,17 @@ func (s Store) Query(ctx context.Context, pageNumber int, rowsPerPage int) ([]Pr
 	return products, nil
 }
 
+// Export gets all Products from the database one at a time. The caller must
+// close the returned iterator.
+func (s Store) Export(ctx context.Context) (*Iterator, error) {
+	rows, err := database.NamedQueryRows(ctx, s.log, s.db, ExportProductQuery, struct{}{})
+	if err != nil {
+		return nil, fmt.Errorf("selecting products: %w", err)
+	}
+
+	return &Iterator{rows: rows}, nil
+}
+
 // QueryByID finds the product identified by a given ID.
 func (s Store) QueryByID(ctx context.Context, productID string) (Product, error) {
 	if err := validate.CheckID(productID); err != nil {
@@ -182,3 +197,29 @@ func (s Store) QueryByUserID(ctx context.Context, userID string) ([]Product, err
 
 	return products, nil
 }
+
+// =============================================================================
+
+// Iterator provides the products of a query one at a time.
+type Iterator struct {
+	rows *database.Rows
+}
+
+// Next returns the next Product. It returns io.EOF when there are no more
+// products.
+func (it *Iterator) Next() (Product, error) {
+	var prd Product
+	if err := it.rows.Next(&prd); err != nil {
+		if err == io.EOF {
+			return Product{}, io.EOF
+		}
+		return Product{}, fmt.Errorf("reading product: %w", err)
+	}
+
+	return prd, nil
+}
+
+// Close releases the connection held by the iterator.
+func (it *Iterator) Close() error {
+	return it.rows.Close()
+}
@@ -26,7 +26,7 @@ func TestProduct(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t, dbc)
 	t.Cleanup(teardown)
 
-	store := product.NewStore(log, db)
+	store := product.NewStore(log, db, auth.DefaultPolicy())
 
 	t.Log("Given the need to work with Product records.")
 	{
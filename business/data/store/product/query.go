@@ -39,6 +39,21 @@ const (
 		user_id
 	OFFSET :offset ROWS FETCH NEXT :rows_per_page ROWS ONLY`
 
+	// ExportProductQuery - declare product export query.
+	ExportProductQuery = `
+	SELECT
+		p.*,
+		COALESCE(SUM(s.quantity) ,0) AS sold,
+		COALESCE(SUM(s.paid), 0) AS revenue
+	FROM
+		products AS p
+	LEFT JOIN
+		sales AS s ON p.product_id = s.product_id
+	GROUP BY
+		p.product_id
+	ORDER BY
+		p.product_id`
+
 	// IDProductQuery - declare product ID query.
 	IDProductQuery = `
 	SELECT
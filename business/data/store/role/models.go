@@ -0,0 +1,39 @@
+package role
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/asishcse60/service/business/sys/validate"
+)
+
+// Role represents a named set of permissions that can be assigned to users.
+type Role struct {
+	Name        string         `db:"name" json:"name"`
+	Permissions pq.StringArray `db:"permissions" json:"permissions"`
+	DateCreated time.Time      `db:"date_created" json:"date_created"`
+	DateUpdated time.Time      `db:"date_updated" json:"date_updated"`
+}
+
+// NewRole contains information needed to create a new Role.
+type NewRole struct {
+	Name        string   `json:"name" validate:"required,uppercase"`
+	Permissions []string `json:"permissions" validate:"required,dive,required"`
+}
+
+// Validate checks the role is named in uppercase and grants permissions.
+func (nr NewRole) Validate() error {
+	return validate.Check(nr)
+}
+
+// UpdateRole defines what information may be provided to modify an existing
+// Role. The set of permissions provided replaces the existing set.
+type UpdateRole struct {
+	Permissions []string `json:"permissions" validate:"required,dive,required"`
+}
+
+// Validate checks the replacement set of permissions.
+func (ur UpdateRole) Validate() error {
+	return validate.Check(ur)
+}
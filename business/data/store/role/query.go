@@ -0,0 +1,45 @@
+package role
+
+const (
+	// CreateRoleQuery - declare role create query.
+	CreateRoleQuery = `
+	INSERT INTO roles
+		(name, permissions, date_created, date_updated)
+	VALUES
+		(:name, :permissions, :date_created, :date_updated)`
+
+	// UpdateRoleQuery - declare role update query.
+	UpdateRoleQuery = `
+	UPDATE
+		roles
+	SET
+		"permissions" = :permissions,
+		"date_updated" = :date_updated
+	WHERE
+		name = :name`
+
+	// DeleteRoleQuery - declare role delete query.
+	DeleteRoleQuery = `
+	DELETE FROM
+		roles
+	WHERE
+		name = :name`
+
+	// ListRoleQuery - declare role list query.
+	ListRoleQuery = `
+	SELECT
+		*
+	FROM
+		roles
+	ORDER BY
+		name`
+
+	// NameRoleQuery - declare role name query.
+	NameRoleQuery = `
+	SELECT
+		*
+	FROM
+		roles
+	WHERE
+		name = :name`
+)
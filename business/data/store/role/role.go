@@ -0,0 +1,162 @@
+// Package role contains role related CRUD functionality.
+package role
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/validate"
+)
+
+// Store manages the set of API's for role access.
+type Store struct {
+	log    *zap.SugaredLogger
+	db     *sqlx.DB
+	policy *auth.Policy
+}
+
+// NewStore constructs a role store for api access.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy) Store {
+	return Store{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Create inserts a new role into the database.
+func (s Store) Create(ctx context.Context, claims auth.Claims, nr NewRole, now time.Time) (Role, error) {
+	if !s.policy.Permitted(claims, auth.PermRoleManage) {
+		return Role{}, database.ErrForbidden
+	}
+	if err := validate.Check(nr); err != nil {
+		return Role{}, fmt.Errorf("validating data: %w", err)
+	}
+	if err := checkPermissions(nr.Permissions); err != nil {
+		return Role{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	rol := Role{
+		Name:        nr.Name,
+		Permissions: nr.Permissions,
+		DateCreated: now,
+		DateUpdated: now,
+	}
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, CreateRoleQuery, rol); err != nil {
+		return Role{}, fmt.Errorf("inserting role: %w", err)
+	}
+
+	return rol, nil
+}
+
+// Update replaces the permissions of a role in the database.
+func (s Store) Update(ctx context.Context, claims auth.Claims, name string, ur UpdateRole, now time.Time) error {
+	if !s.policy.Permitted(claims, auth.PermRoleManage) {
+		return database.ErrForbidden
+	}
+	if err := validate.Check(ur); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+	if err := checkPermissions(ur.Permissions); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+
+	rol, err := s.QueryByName(ctx, name)
+	if err != nil {
+		return fmt.Errorf("updating role name[%s]: %w", name, err)
+	}
+
+	rol.Permissions = ur.Permissions
+	rol.DateUpdated = now
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, UpdateRoleQuery, rol); err != nil {
+		return fmt.Errorf("updating role name[%s]: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete removes a role from the database. The built-in roles can't be
+// deleted since every account would lose the permissions they grant.
+func (s Store) Delete(ctx context.Context, claims auth.Claims, name string) error {
+	if !s.policy.Permitted(claims, auth.PermRoleManage) {
+		return database.ErrForbidden
+	}
+	if name == auth.RoleAdmin || name == auth.RoleUser {
+		return database.ErrForbidden
+	}
+
+	data := struct {
+		Name string `db:"name"`
+	}{
+		Name: name,
+	}
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, DeleteRoleQuery, data); err != nil {
+		return fmt.Errorf("deleting role name[%s]: %w", name, err)
+	}
+
+	return nil
+}
+
+// Query retrieves the full list of roles from the database.
+func (s Store) Query(ctx context.Context) ([]Role, error) {
+	var roles []Role
+	if err := database.NamedQuerySlice(ctx, s.log, s.db, ListRoleQuery, struct{}{}, &roles); err != nil {
+		if err == database.ErrNotFound {
+			return nil, database.ErrNotFound
+		}
+		return nil, fmt.Errorf("selecting roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// QueryByName gets the specified role from the database.
+func (s Store) QueryByName(ctx context.Context, name string) (Role, error) {
+	data := struct {
+		Name string `db:"name"`
+	}{
+		Name: name,
+	}
+
+	var rol Role
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, NameRoleQuery, data, &rol); err != nil {
+		if err == database.ErrNotFound {
+			return Role{}, database.ErrNotFound
+		}
+		return Role{}, fmt.Errorf("selecting role name[%q]: %w", name, err)
+	}
+
+	return rol, nil
+}
+
+// checkPermissions validates that every permission is known to the system.
+func checkPermissions(perms []string) error {
+	known := make(map[string]bool)
+	for _, perm := range auth.Permissions() {
+		known[perm] = true
+	}
+
+	var fields validate.FieldErrors
+	for _, perm := range perms {
+		if !known[perm] {
+			fields = append(fields, validate.FieldError{
+				Field: "permissions",
+				Error: fmt.Sprintf("%s is not a known permission", perm),
+			})
+		}
+	}
+
+	if fields != nil {
+		return fields
+	}
+	return nil
+}
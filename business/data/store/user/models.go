@@ -4,15 +4,27 @@ import (
 	"time"
 
 	"github.com/lib/pq"
+
+	"github.com/asishcse60/service/business/sys/validate"
+)
+
+// These are the expected values for User.Status.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
 )
 
-// User represents an individual user.
+// User represents an individual user. The token version is embedded in the
+// claims of every token issued to the user and is incremented whenever those
+// tokens must no longer be accepted.
 type User struct {
 	ID           string         `db:"user_id" json:"id"`
 	Name         string         `db:"name" json:"name"`
 	Email        string         `db:"email" json:"email"`
 	Roles        pq.StringArray `db:"roles" json:"roles"`
 	PasswordHash []byte         `db:"password_hash" json:"-"`
+	Status       string         `db:"status" json:"status"`
+	TokenVersion int            `db:"token_version" json:"-"`
 	DateCreated  time.Time      `db:"date_created" json:"date_created"`
 	DateUpdated  time.Time      `db:"date_updated" json:"date_updated"`
 }
@@ -26,6 +38,12 @@ type NewUser struct {
 	PasswordConfirm string   `json:"password_confirm" validate:"eqfield=Password"`
 }
 
+// Validate checks the fields required to create a User, including that
+// the password was confirmed.
+func (nu NewUser) Validate() error {
+	return validate.Check(nu)
+}
+
 // UpdateUser defines what information may be provided to modify an existing
 // User. All fields are optional so clients can send just the fields they want
 // changed. It uses pointer fields so we can differentiate between a field that
@@ -39,3 +57,38 @@ type UpdateUser struct {
 	Password        *string  `json:"password"`
 	PasswordConfirm *string  `json:"password_confirm" validate:"omitempty,eqfield=Password"`
 }
+
+// Validate checks the fields provided to modify a User.
+func (uu UpdateUser) Validate() error {
+	return validate.Check(uu)
+}
+
+// UpdateStatus defines the information needed to suspend or reactivate an
+// existing User.
+type UpdateStatus struct {
+	Status string `json:"status" validate:"required,oneof=active suspended"`
+}
+
+// Validate checks the status is one a User can be set to.
+func (us UpdateStatus) Validate() error {
+	return validate.Check(us)
+}
+
+// Identity links a user to the subject of an external identity provider.
+type Identity struct {
+	Issuer      string    `db:"issuer"`
+	Subject     string    `db:"subject"`
+	UserID      string    `db:"user_id"`
+	DateCreated time.Time `db:"date_created"`
+}
+
+// NewIdentity contains the information an external identity provider
+// asserts about a user. It is used to find the linked user or to provision
+// a new one.
+type NewIdentity struct {
+	Issuer        string `validate:"required"`
+	Subject       string `validate:"required"`
+	Email         string `validate:"required,email"`
+	EmailVerified bool
+	Name          string
+}
@@ -3,9 +3,9 @@ package user
 const (
 	// CreateUserQuery - declare user create query.
 	CreateUserQuery = `INSERT INTO users
-		(user_id, name, email, password_hash, roles, date_created, date_updated)
+		(user_id, name, email, password_hash, roles, status, token_version, date_created, date_updated)
 	VALUES
-		(:user_id, :name, :email, :password_hash, :roles, :date_created, :date_updated)`
+		(:user_id, :name, :email, :password_hash, :roles, :status, :token_version, :date_created, :date_updated)`
 
 	// UpdateUserQuery - declare user update query.
 	UpdateUserQuery = `UPDATE 
@@ -15,10 +15,31 @@ const (
 							"email" = :email,
 							"roles" = :roles,
 							"password_hash" = :password_hash,
+							"status" = :status,
+							"token_version" = :token_version,
 							"date_updated" = :date_updated
 						WHERE
 							user_id = :user_id`
 
+	// RevokeUserQuery - declare user token revocation query.
+	RevokeUserQuery = `
+	UPDATE
+		users
+	SET
+		"token_version" = token_version + 1,
+		"date_updated" = :date_updated
+	WHERE
+		user_id = :user_id`
+
+	// UpdatePasswordHashQuery - declare user password hash update query.
+	UpdatePasswordHashQuery = `
+	UPDATE
+		users
+	SET
+		"password_hash" = :password_hash
+	WHERE
+		user_id = :user_id`
+
 	// DeleteUserQuery - declare user delete query.
 	DeleteUserQuery = `
 	DELETE FROM
@@ -45,6 +66,32 @@ const (
 	WHERE 
 		user_id = :user_id`
 
+	// StatusUserQuery - declare user status query.
+	StatusUserQuery = `
+	SELECT
+		status, token_version
+	FROM
+		users
+	WHERE
+		user_id = :user_id`
+
+	// IdentityUserQuery - declare user identity query.
+	IdentityUserQuery = `
+	SELECT
+		u.*
+	FROM
+		users AS u
+	JOIN
+		user_identities AS i ON i.user_id = u.user_id
+	WHERE
+		i.issuer = :issuer AND i.subject = :subject`
+
+	// CreateIdentityQuery - declare user identity create query.
+	CreateIdentityQuery = `INSERT INTO user_identities
+		(issuer, subject, user_id, date_created)
+	VALUES
+		(:issuer, :subject, :user_id, :date_created)`
+
 	// EmailUserQuery - declare user Email query.
 	EmailUserQuery = `
 	SELECT
@@ -3,40 +3,59 @@ package user
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 	"github.com/asishcse60/service/business/sys/validate"
+	"github.com/asishcse60/service/foundation/web"
 )
 
+// impersonationTTL is how long a token issued to an admin acting as another
+// user remains valid.
+const impersonationTTL = 15 * time.Minute
+
 // Store manages the set of API's for user access.
 type Store struct {
-	log *zap.SugaredLogger
-	db  *sqlx.DB
+	log    *zap.SugaredLogger
+	db     *sqlx.DB
+	policy *auth.Policy
+	hasher password.Hasher
 }
 
-// NewStore constructs a user store for api access.
-func NewStore(log *zap.SugaredLogger, db *sqlx.DB) Store {
+// NewStore constructs a user store for api access. The policy is used to
+// decide if the claims of a caller allow access to a user and the hasher is
+// used to hash and verify passwords.
+func NewStore(log *zap.SugaredLogger, db *sqlx.DB, policy *auth.Policy, hasher password.Hasher) Store {
 	return Store{
-		log: log,
-		db:  db,
+		log:    log,
+		db:     db,
+		policy: policy,
+		hasher: hasher,
 	}
 }
 
-// Create inserts a new user into the database.
-func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, error) {
+// Create inserts a new user into the database. The caller can only give the
+// user roles which grant no more than the caller is permitted.
+func (s Store) Create(ctx context.Context, claims auth.Claims, nu NewUser, now time.Time) (User, error) {
+	if !s.policy.Permitted(claims, auth.PermUserCreate) || !s.policy.Grantable(claims, nu.Roles...) {
+		return User{}, database.ErrForbidden
+	}
 	if err := validate.Check(nu); err != nil {
 		return User{}, fmt.Errorf("validating data: %w", err)
 	}
+	if err := validate.Password(nu.Password); err != nil {
+		return User{}, fmt.Errorf("validating data: %w", err)
+	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(nu.Password), bcrypt.DefaultCost)
+	hash, err := s.hasher.Hash(ctx, nu.Password)
 	if err != nil {
 		return User{}, fmt.Errorf("generating password hash: %w", err)
 	}
@@ -47,6 +66,7 @@ func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, err
 		Email:        nu.Email,
 		PasswordHash: hash,
 		Roles:        nu.Roles,
+		Status:       StatusActive,
 		DateCreated:  now,
 		DateUpdated:  now,
 	}
@@ -58,7 +78,9 @@ func (s Store) Create(ctx context.Context, nu NewUser, now time.Time) (User, err
 	return usr, nil
 }
 
-// Update replaces a user document in the database.
+// Update replaces a user document in the database. Roles can only be changed
+// by someone else, and only when both the old and the new roles grant no more
+// than the caller is permitted.
 func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu UpdateUser, now time.Time) error {
 	if err := validate.CheckID(userID); err != nil {
 		return database.ErrInvalidID
@@ -66,6 +88,16 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	if err := validate.Check(uu); err != nil {
 		return fmt.Errorf("validating data: %w", err)
 	}
+	if uu.Password != nil {
+		if err := validate.Password(*uu.Password); err != nil {
+			return fmt.Errorf("validating data: %w", err)
+		}
+	}
+
+	// If you are not allowed to update someone else and this is not yourself.
+	if !s.policy.PermittedOwner(claims, userID, auth.PermUserUpdateAny, auth.PermUserUpdateOwn) {
+		return database.ErrForbidden
+	}
 
 	usr, err := s.QueryByID(ctx, claims, userID)
 	if err != nil {
@@ -78,15 +110,20 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	if uu.Email != nil {
 		usr.Email = *uu.Email
 	}
-	if uu.Roles != nil {
+	if uu.Roles != nil && !equalRoles(usr.Roles, uu.Roles) {
+		if claims.Subject == userID || !s.policy.Grantable(claims, usr.Roles...) || !s.policy.Grantable(claims, uu.Roles...) {
+			return database.ErrForbidden
+		}
 		usr.Roles = uu.Roles
+		usr.TokenVersion++
 	}
 	if uu.Password != nil {
-		pw, err := bcrypt.GenerateFromPassword([]byte(*uu.Password), bcrypt.DefaultCost)
+		pw, err := s.hasher.Hash(ctx, *uu.Password)
 		if err != nil {
 			return fmt.Errorf("generating password hash: %w", err)
 		}
 		usr.PasswordHash = pw
+		usr.TokenVersion++
 	}
 	usr.DateUpdated = now
 
@@ -97,14 +134,76 @@ func (s Store) Update(ctx context.Context, claims auth.Claims, userID string, uu
 	return nil
 }
 
-// Delete removes a user from the database.
+// UpdateStatus suspends or reactivates a user. Changing the status revokes
+// every token that was issued to the user.
+func (s Store) UpdateStatus(ctx context.Context, claims auth.Claims, userID string, us UpdateStatus, now time.Time) error {
+	if err := validate.CheckID(userID); err != nil {
+		return database.ErrInvalidID
+	}
+	if err := validate.Check(us); err != nil {
+		return fmt.Errorf("validating data: %w", err)
+	}
+
+	if !s.policy.Permitted(claims, auth.PermUserUpdateAny) {
+		return database.ErrForbidden
+	}
+
+	usr, err := s.QueryByID(ctx, claims, userID)
+	if err != nil {
+		return fmt.Errorf("updating user status userID[%s]: %w", userID, err)
+	}
+
+	if usr.Status == us.Status {
+		return nil
+	}
+
+	usr.Status = us.Status
+	usr.TokenVersion++
+	usr.DateUpdated = now
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, UpdateUserQuery, usr); err != nil {
+		return fmt.Errorf("updating status userID[%s]: %w", userID, err)
+	}
+
+	return nil
+}
+
+// Revoke invalidates every token issued to the subject of the claims, like
+// when logging out everywhere, so a copy of a token can't be used anymore.
+// An admin impersonating the subject is not allowed to revoke its tokens.
+func (s Store) Revoke(ctx context.Context, claims auth.Claims, now time.Time) error {
+	if claims.Impersonating() {
+		return database.ErrForbidden
+	}
+
+	if err := validate.CheckID(claims.Subject); err != nil {
+		return database.ErrInvalidID
+	}
+
+	data := struct {
+		UserID      string    `db:"user_id"`
+		DateUpdated time.Time `db:"date_updated"`
+	}{
+		UserID:      claims.Subject,
+		DateUpdated: now,
+	}
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, RevokeUserQuery, data); err != nil {
+		return fmt.Errorf("revoking tokens userID[%s]: %w", claims.Subject, err)
+	}
+
+	return nil
+}
+
+// Delete removes a user from the database. The policy doesn't allow users to
+// be deleted while impersonating.
 func (s Store) Delete(ctx context.Context, claims auth.Claims, userID string) error {
 	if err := validate.CheckID(userID); err != nil {
 		return database.ErrInvalidID
 	}
 
-	// If you are not an admin and looking to delete someone other than yourself.
-	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+	// If you are not allowed to delete someone else and this is not yourself.
+	if !s.policy.PermittedOwner(claims, userID, auth.PermUserDeleteAny, auth.PermUserDeleteOwn) {
 		return database.ErrForbidden
 	}
 
@@ -148,8 +247,8 @@ func (s Store) QueryByID(ctx context.Context, claims auth.Claims, userID string)
 		return User{}, database.ErrInvalidID
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != userID {
+	// If you are not allowed to retrieve someone else and this is not yourself.
+	if !s.policy.PermittedOwner(claims, userID, auth.PermUserReadAny, auth.PermUserReadOwn) {
 		return User{}, database.ErrForbidden
 	}
 
@@ -192,8 +291,8 @@ func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email strin
 		return User{}, fmt.Errorf("selecting email[%q]: %w", email, err)
 	}
 
-	// If you are not an admin and looking to retrieve someone other than yourself.
-	if !claims.Authorized(auth.RoleAdmin) && claims.Subject != usr.ID {
+	// If you are not allowed to retrieve someone else and this is not yourself.
+	if !s.policy.PermittedOwner(claims, usr.ID, auth.PermUserReadAny, auth.PermUserReadOwn) {
 		return User{}, database.ErrForbidden
 	}
 
@@ -203,7 +302,7 @@ func (s Store) QueryByEmail(ctx context.Context, claims auth.Claims, email strin
 // Authenticate finds a user by their email and verifies their password. On
 // success it returns a Claims User representing this user. The claims can be
 // used to generate a token for future authentication.
-func (s Store) Authenticate(ctx context.Context, now time.Time, email, password string) (auth.Claims, error) {
+func (s Store) Authenticate(ctx context.Context, now time.Time, email, pass string) (auth.Claims, error) {
 	data := struct {
 		Email string `db:"email"`
 	}{
@@ -218,23 +317,313 @@ func (s Store) Authenticate(ctx context.Context, now time.Time, email, password
 		return auth.Claims{}, fmt.Errorf("selecting user[%q]: %w", email, err)
 	}
 
-	// Compare the provided password with the saved hash. Use the bcrypt
-	// comparison function so it is cryptographically secure.
-	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(password)); err != nil {
+	// Compare the provided password with the saved hash. The hasher uses the
+	// algorithm and parameters recorded in the hash so it is cryptographically
+	// secure.
+	if err := s.hasher.Compare(ctx, usr.PasswordHash, pass); err != nil {
+		if errors.Is(err, password.ErrSaturated) || errors.Is(err, password.ErrClosed) || ctx.Err() != nil {
+			return auth.Claims{}, fmt.Errorf("comparing password: %w", err)
+		}
 		return auth.Claims{}, database.ErrAuthenticationFailure
 	}
 
+	// The suspension is only revealed to someone who knows the password.
+	if usr.Status == StatusSuspended {
+		return auth.Claims{}, database.ErrAccountSuspended
+	}
+
+	// Now that we know the password, upgrade hashes that were produced by an
+	// older algorithm or with outdated parameters. A failure here should not
+	// prevent the user from authenticating.
+	if s.hasher.NeedsRehash(usr.PasswordHash) {
+		if err := s.rehash(ctx, usr, pass); err != nil {
+			s.log.Errorw("rehashing password", "traceid", web.GetTraceID(ctx), "userid", usr.ID, "ERROR", err)
+		}
+	}
+
 	// If we are this far the request is valid. Create some claims for the user
 	// and generate their token.
-	claims := auth.Claims{
+	return claims(usr), nil
+}
+
+// AuthenticateIdentity finds the user linked to an identity asserted by an
+// external provider. The first time an identity is seen it is linked to the
+// user with the same email when the provider verified the email, otherwise
+// a new user with the USER role is provisioned. On success it returns the
+// claims representing the user.
+func (s Store) AuthenticateIdentity(ctx context.Context, now time.Time, ni NewIdentity) (auth.Claims, error) {
+	if err := validate.Check(ni); err != nil {
+		return auth.Claims{}, fmt.Errorf("validating data: %w", err)
+	}
+
+	data := struct {
+		Issuer  string `db:"issuer"`
+		Subject string `db:"subject"`
+	}{
+		Issuer:  ni.Issuer,
+		Subject: ni.Subject,
+	}
+
+	var usr User
+	err := database.NamedQueryStruct(ctx, s.log, s.db, IdentityUserQuery, data, &usr)
+	switch {
+	case err == nil:
+	case errors.Is(err, database.ErrNotFound):
+		if usr, err = s.provision(ctx, ni, now); err != nil {
+			return auth.Claims{}, err
+		}
+	default:
+		return auth.Claims{}, fmt.Errorf("selecting identity[%s:%s]: %w", ni.Issuer, ni.Subject, err)
+	}
+
+	if usr.Status == StatusSuspended {
+		return auth.Claims{}, database.ErrAccountSuspended
+	}
+
+	return claims(usr), nil
+}
+
+// provision links the identity to the user with the same email, or to a new
+// user when there is none. A user created this way has no password so it can
+// only log in through the provider. Users holding more than the USER role
+// are never linked automatically, a provider account must not be enough to
+// take over an admin. When two first logins of the identity race, the one
+// losing finds the identity linked by the other.
+func (s Store) provision(ctx context.Context, ni NewIdentity, now time.Time) (User, error) {
+	var usr User
+
+	f := func(tx sqlx.ExtContext) error {
+		data := struct {
+			Email string `db:"email"`
+		}{
+			Email: ni.Email,
+		}
+
+		err := database.NamedQueryStruct(ctx, s.log, tx, EmailUserQuery, data, &usr)
+		switch {
+		case err == nil:
+
+			// Linking an existing user is only safe when the provider has
+			// verified the email belongs to the subject.
+			if !ni.EmailVerified {
+				return database.ErrAuthenticationFailure
+			}
+			for _, role := range usr.Roles {
+				if role != auth.RoleUser {
+					return database.ErrAuthenticationFailure
+				}
+			}
+
+		case errors.Is(err, database.ErrNotFound):
+			name := ni.Name
+			if name == "" {
+				name = ni.Email
+			}
+
+			usr = User{
+				ID:          validate.GenerateID(),
+				Name:        name,
+				Email:       ni.Email,
+				Roles:       []string{auth.RoleUser},
+				Status:      StatusActive,
+				DateCreated: now,
+				DateUpdated: now,
+			}
+
+			if err := database.NamedExecContext(ctx, s.log, tx, CreateUserQuery, usr); err != nil {
+				return fmt.Errorf("inserting user: %w", err)
+			}
+
+		default:
+			return fmt.Errorf("selecting user[%q]: %w", ni.Email, err)
+		}
+
+		id := Identity{
+			Issuer:      ni.Issuer,
+			Subject:     ni.Subject,
+			UserID:      usr.ID,
+			DateCreated: now,
+		}
+
+		if err := database.NamedExecContext(ctx, s.log, tx, CreateIdentityQuery, id); err != nil {
+			return fmt.Errorf("inserting identity: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := database.WithinTran(ctx, s.log, s.db, f); err != nil {
+		switch {
+		case errors.Is(err, database.ErrAuthenticationFailure):
+			return User{}, database.ErrAuthenticationFailure
+		case errors.Is(err, database.ErrDuplicate):
+			data := struct {
+				Issuer  string `db:"issuer"`
+				Subject string `db:"subject"`
+			}{
+				Issuer:  ni.Issuer,
+				Subject: ni.Subject,
+			}
+			if err := database.NamedQueryStruct(ctx, s.log, s.db, IdentityUserQuery, data, &usr); err != nil {
+				return User{}, fmt.Errorf("selecting identity[%s:%s]: %w", ni.Issuer, ni.Subject, err)
+			}
+			return usr, nil
+		}
+		return User{}, fmt.Errorf("provisioning identity[%s:%s]: %w", ni.Issuer, ni.Subject, err)
+	}
+
+	return usr, nil
+}
+
+// Impersonate returns short lived claims for the specified user that record
+// the subject of the caller as the actor. An admin can't impersonate
+// themselves, a suspended user, or a user whose roles grant permissions the
+// admin doesn't hold. Only our users can impersonate, the actor of the
+// claims must be a user we can check is still current.
+func (s Store) Impersonate(ctx context.Context, claims auth.Claims, userID string, now time.Time) (auth.Claims, error) {
+	if err := validate.CheckID(userID); err != nil {
+		return auth.Claims{}, database.ErrInvalidID
+	}
+
+	if err := validate.CheckID(claims.Subject); err != nil {
+		return auth.Claims{}, database.ErrForbidden
+	}
+
+	if !s.policy.Permitted(claims, auth.PermUserImpersonate) || claims.Subject == userID {
+		return auth.Claims{}, database.ErrForbidden
+	}
+
+	usr, err := s.QueryByID(ctx, claims, userID)
+	if err != nil {
+		return auth.Claims{}, fmt.Errorf("impersonating userID[%s]: %w", userID, err)
+	}
+
+	if usr.Status == StatusSuspended {
+		return auth.Claims{}, database.ErrAccountSuspended
+	}
+
+	if !s.policy.Grantable(claims, usr.Roles...) {
+		return auth.Claims{}, database.ErrForbidden
+	}
+
+	imp := auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   usr.ID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(impersonationTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Roles:   usr.Roles,
+		Version: usr.TokenVersion,
+		Actor:   &auth.Actor{Subject: claims.Subject, Version: claims.Version},
+	}
+
+	return imp, nil
+}
+
+// CheckClaims verifies the subject of the claims still exists, is not
+// suspended and that the claims carry the current token version. The actor
+// of an impersonation is held to the same checks, suspending the admin or
+// revoking its tokens ends the impersonation as well.
+func (s Store) CheckClaims(ctx context.Context, claims auth.Claims) error {
+	if err := s.checkVersion(ctx, claims.Subject, claims.Version); err != nil {
+		return err
+	}
+
+	if claims.Impersonating() {
+		if err := s.checkVersion(ctx, claims.Actor.Subject, claims.Actor.Version); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkVersion verifies the user still exists, is not suspended and that the
+// version is its current token version.
+func (s Store) checkVersion(ctx context.Context, userID string, version int) error {
+	if err := validate.CheckID(userID); err != nil {
+		return auth.ErrRevoked
+	}
+
+	data := struct {
+		UserID string `db:"user_id"`
+	}{
+		UserID: userID,
+	}
+
+	var state struct {
+		Status       string `db:"status"`
+		TokenVersion int    `db:"token_version"`
+	}
+	if err := database.NamedQueryStruct(ctx, s.log, s.db, StatusUserQuery, data, &state); err != nil {
+		if err == database.ErrNotFound {
+			return auth.ErrRevoked
+		}
+		return fmt.Errorf("selecting status userID[%q]: %w", userID, err)
+	}
+
+	if state.Status == StatusSuspended {
+		return database.ErrAccountSuspended
+	}
+	if state.TokenVersion != version {
+		return auth.ErrRevoked
+	}
+
+	return nil
+}
+
+// rehash replaces the password hash of the user with a hash produced by the
+// current hasher.
+func (s Store) rehash(ctx context.Context, usr User, pass string) error {
+	hash, err := s.hasher.Hash(ctx, pass)
+	if err != nil {
+		return fmt.Errorf("generating password hash: %w", err)
+	}
+
+	data := struct {
+		UserID       string `db:"user_id"`
+		PasswordHash []byte `db:"password_hash"`
+	}{
+		UserID:       usr.ID,
+		PasswordHash: hash,
+	}
+
+	if err := database.NamedExecContext(ctx, s.log, s.db, UpdatePasswordHashQuery, data); err != nil {
+		return fmt.Errorf("updating password hash userID[%s]: %w", usr.ID, err)
+	}
+
+	return nil
+}
+
+// equalRoles returns true if both sets of roles contain the same roles.
+func equalRoles(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	set := make(map[string]int, len(a))
+	for _, role := range a {
+		set[role]++
+	}
+	for _, role := range b {
+		if set[role] == 0 {
+			return false
+		}
+		set[role]--
+	}
+	return true
+}
+
+// claims returns the claims representing the user. The issuer and audience
+// are stamped when the token is generated.
+func claims(usr User) auth.Claims {
+	return auth.Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "service project",
 			Subject:   usr.ID,
 			ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
 		},
-		Roles: usr.Roles,
+		Roles:   usr.Roles,
+		Version: usr.TokenVersion,
 	}
-
-	return claims, nil
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/asishcse60/service/business/data/tests"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 )
 
 var dbc = tests.DBContainer{
@@ -22,11 +23,14 @@ var dbc = tests.DBContainer{
 	Args:  []string{"-e", "POSTGRES_PASSWORD=postgres"},
 }
 
+// operator are the claims of an admin setting up the users of a test.
+var operator = auth.Claims{Roles: []string{auth.RoleAdmin}}
+
 func TestUser(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t, dbc)
 	t.Cleanup(teardown)
 
-	store := user.NewStore(log, db)
+	store := user.NewStore(log, db, auth.DefaultPolicy(), password.Default(password.DefaultParams))
 
 	t.Log("Given the need to work with User records.")
 	{
@@ -44,7 +48,7 @@ func TestUser(t *testing.T) {
 				PasswordConfirm: "gophers",
 			}
 
-			usr, err := store.Create(ctx, nu, now)
+			usr, err := store.Create(ctx, operator, nu, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
@@ -52,7 +56,6 @@ func TestUser(t *testing.T) {
 
 			claims := auth.Claims{
 				RegisteredClaims: jwt.RegisteredClaims{
-					Issuer:    "service project",
 					Subject:   usr.ID,
 					ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
 					IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
@@ -126,6 +129,72 @@ func TestUser(t *testing.T) {
 	}
 }
 
+func TestGrantRoles(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t, dbc)
+	t.Cleanup(teardown)
+
+	const roleSupport = "SUPPORT"
+
+	policy := auth.DefaultPolicy()
+	roles := auth.DefaultRoles()
+	roles[roleSupport] = append([]string{auth.PermUserCreate, auth.PermUserReadAny, auth.PermUserUpdateAny}, roles[auth.RoleUser]...)
+	policy.Load(roles)
+
+	store := user.NewStore(log, db, policy, password.Default(password.DefaultParams))
+
+	t.Log("Given the need to keep users from granting more than they hold.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a custom role can manage users.", testID)
+		{
+			ctx := context.Background()
+			now := time.Now().UTC()
+
+			newUser := func(email string, roles ...string) user.NewUser {
+				return user.NewUser{
+					Name:            email,
+					Email:           email,
+					Roles:           roles,
+					Password:        "gophers",
+					PasswordConfirm: "gophers",
+				}
+			}
+
+			sup, err := store.Create(ctx, operator, newUser("support@example.com", roleSupport), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the support user : %s.", tests.Failed, testID, err)
+			}
+			support := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: sup.ID},
+				Roles:            []string{roleSupport},
+			}
+
+			usr, err := store.Create(ctx, support, newUser("user@example.com", auth.RoleUser), now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a regular user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a regular user.", tests.Success, testID)
+
+			if _, err := store.Create(ctx, support, newUser("admin@example.com", auth.RoleAdmin), now); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to create an admin : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to create an admin.", tests.Success, testID)
+
+			promote := user.UpdateUser{Roles: []string{auth.RoleAdmin}}
+			if err := store.Update(ctx, support, usr.ID, promote, now); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to promote a user to admin : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to promote a user to admin.", tests.Success, testID)
+
+			demote := user.UpdateUser{Roles: []string{auth.RoleUser}}
+			if err := store.Update(ctx, support, sup.ID, demote, now); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to change their own roles : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to change their own roles.", tests.Success, testID)
+		}
+	}
+}
+
 func TestPagingUser(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t, dbc)
 	t.Cleanup(teardown)
@@ -135,7 +204,7 @@ func TestPagingUser(t *testing.T) {
 
 	schema.Seed(ctx, db)
 
-	store := user.NewStore(log, db)
+	store := user.NewStore(log, db, auth.DefaultPolicy(), password.Default(password.DefaultParams))
 
 	t.Log("Given the need to page through User records.")
 	{
@@ -180,7 +249,7 @@ func TestAuthenticate(t *testing.T) {
 	log, db, teardown := tests.NewUnit(t, dbc)
 	t.Cleanup(teardown)
 
-	store := user.NewStore(log, db)
+	store := user.NewStore(log, db, auth.DefaultPolicy(), password.Default(password.DefaultParams))
 
 	t.Log("Given the need to authenticate users")
 	{
@@ -198,7 +267,7 @@ func TestAuthenticate(t *testing.T) {
 				PasswordConfirm: "goroutines",
 			}
 
-			usr, err := store.Create(ctx, nu, now)
+			usr, err := store.Create(ctx, operator, nu, now)
 			if err != nil {
 				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
 			}
@@ -213,7 +282,6 @@ func TestAuthenticate(t *testing.T) {
 			want := auth.Claims{
 				Roles: usr.Roles,
 				RegisteredClaims: jwt.RegisteredClaims{
-					Issuer:    "service project",
 					Subject:   usr.ID,
 					ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
 					IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
@@ -224,6 +292,231 @@ func TestAuthenticate(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould get back the expected claims. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the expected claims.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the claims : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the claims.", tests.Success, testID)
+
+			if err := store.UpdateStatus(ctx, claims, usr.ID, user.UpdateStatus{Status: user.StatusSuspended}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to suspend user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to suspend user.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); !errors.Is(err, database.ErrAccountSuspended) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the claims of a suspended user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the claims of a suspended user.", tests.Success, testID)
+
+			if _, err := store.Authenticate(ctx, now, "anna@ardanlabs.com", "goroutines"); !errors.Is(err, database.ErrAccountSuspended) {
+				t.Fatalf("\t%s\tTest %d:\tShould not authenticate a suspended user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not authenticate a suspended user.", tests.Success, testID)
+
+			if _, err := store.Authenticate(ctx, now, "anna@ardanlabs.com", "wrong"); !errors.Is(err, database.ErrAuthenticationFailure) {
+				t.Fatalf("\t%s\tTest %d:\tShould not reveal the suspension without the password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not reveal the suspension without the password.", tests.Success, testID)
+
+			if err := store.UpdateStatus(ctx, claims, usr.ID, user.UpdateStatus{Status: user.StatusActive}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reactivate user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reactivate user.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); !errors.Is(err, auth.ErrRevoked) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject claims issued before the suspension : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject claims issued before the suspension.", tests.Success, testID)
+
+			claims, err = store.Authenticate(ctx, now, "anna@ardanlabs.com", "goroutines")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authenticate user again : %s.", tests.Failed, testID, err)
+			}
+
+			imp := claims
+			imp.Actor = &auth.Actor{Subject: "5cf37266-3473-4006-984f-9325122678b7"}
+			if err := store.Revoke(ctx, imp, now); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to revoke the tokens while impersonating : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to revoke the tokens while impersonating.", tests.Success, testID)
+
+			if err := store.Revoke(ctx, claims, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the tokens : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the tokens.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); !errors.Is(err, auth.ErrRevoked) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject claims issued before the revocation : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject claims issued before the revocation.", tests.Success, testID)
+		}
+	}
+}
+
+func TestImpersonate(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t, dbc)
+	t.Cleanup(teardown)
+
+	store := user.NewStore(log, db, auth.DefaultPolicy(), password.Default(password.DefaultParams))
+
+	t.Log("Given the need to let admins act as other users")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen impersonating a user.", testID)
+		{
+			ctx := context.Background()
+			now := time.Now().UTC()
+
+			nu := user.NewUser{
+				Name:            "Jacob Walker",
+				Email:           "jacob@ardanlabs.com",
+				Roles:           []string{auth.RoleUser},
+				Password:        "channels",
+				PasswordConfirm: "channels",
+			}
+
+			usr, err := store.Create(ctx, operator, nu, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			na := user.NewUser{
+				Name:            "Ada Walker",
+				Email:           "ada@ardanlabs.com",
+				Roles:           []string{auth.RoleAdmin},
+				Password:        "goroutines",
+				PasswordConfirm: "goroutines",
+			}
+
+			adm, err := store.Create(ctx, operator, na, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create admin : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create admin.", tests.Success, testID)
+
+			admin := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject: adm.ID,
+				},
+				Roles: adm.Roles,
+			}
+
+			claims, err := store.Impersonate(ctx, admin, usr.ID, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to impersonate the user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to impersonate the user.", tests.Success, testID)
+
+			if claims.Subject != usr.ID || claims.ActorSubject() != admin.Subject {
+				t.Fatalf("\t%s\tTest %d:\tShould record the admin as the actor : %+v.", tests.Failed, testID, claims)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the admin as the actor.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the claims : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the claims.", tests.Success, testID)
+
+			if err := store.Delete(ctx, claims, usr.ID); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to delete while impersonating : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to delete while impersonating.", tests.Success, testID)
+
+			if _, err := store.Impersonate(ctx, claims, usr.ID, now); !errors.Is(err, database.ErrForbidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to impersonate while impersonating : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to impersonate while impersonating.", tests.Success, testID)
+
+			if err := store.Revoke(ctx, admin, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the tokens of the admin : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to revoke the tokens of the admin.", tests.Success, testID)
+
+			if err := store.CheckClaims(ctx, claims); !errors.Is(err, auth.ErrRevoked) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the claims once the admin is revoked : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the claims once the admin is revoked.", tests.Success, testID)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t, dbc)
+	t.Cleanup(teardown)
+
+	store := user.NewStore(log, db, auth.DefaultPolicy(), password.Default(password.DefaultParams))
+
+	t.Log("Given the need to log users in through an external identity provider")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a new identity.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			ni := user.NewIdentity{
+				Issuer:        "https://idp.example.com",
+				Subject:       "idp|12345",
+				Email:         "jill@ardanlabs.com",
+				EmailVerified: true,
+				Name:          "Jill Walker",
+			}
+
+			claims, err := store.AuthenticateIdentity(ctx, now, ni)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to provision the user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to provision the user.", tests.Success, testID)
+
+			if len(claims.Roles) != 1 || claims.Roles[0] != auth.RoleUser {
+				t.Fatalf("\t%s\tTest %d:\tShould grant the USER role : %v.", tests.Failed, testID, claims.Roles)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant the USER role.", tests.Success, testID)
+
+			again, err := store.AuthenticateIdentity(ctx, now, ni)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to log in again : %s.", tests.Failed, testID, err)
+			}
+			if again.Subject != claims.Subject {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same user : %s.", tests.Failed, testID, again.Subject)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same user.", tests.Success, testID)
+
+			if _, err := store.Authenticate(ctx, now, ni.Email, ""); !errors.Is(err, database.ErrAuthenticationFailure) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to log in with a password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to log in with a password.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the email of an identity belongs to an existing user.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			ni := user.NewIdentity{
+				Issuer:  "https://other.example.com",
+				Subject: "other|12345",
+				Email:   "jill@ardanlabs.com",
+			}
+
+			if _, err := store.AuthenticateIdentity(ctx, now, ni); !errors.Is(err, database.ErrAuthenticationFailure) {
+				t.Fatalf("\t%s\tTest %d:\tShould not link an unverified email : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not link an unverified email.", tests.Success, testID)
+
+			ni = user.NewIdentity{
+				Issuer:        "https://other.example.com",
+				Subject:       "other|67890",
+				Email:         "admin@example.com",
+				EmailVerified: true,
+			}
+
+			if _, err := store.AuthenticateIdentity(ctx, now, ni); !errors.Is(err, database.ErrAuthenticationFailure) {
+				t.Fatalf("\t%s\tTest %d:\tShould not link an admin : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not link an admin.", tests.Success, testID)
 		}
 	}
 }
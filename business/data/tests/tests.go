@@ -4,6 +4,7 @@ package tests
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
@@ -19,6 +20,7 @@ import (
 	"github.com/asishcse60/service/business/data/store/user"
 	"github.com/asishcse60/service/business/sys/auth"
 	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
 	"github.com/asishcse60/service/foundation/docker"
 	"github.com/asishcse60/service/foundation/keystore"
 	"github.com/asishcse60/service/foundation/logger"
@@ -106,6 +108,9 @@ type Test struct {
 	DB       *sqlx.DB
 	Log      *zap.SugaredLogger
 	Auth     *auth.Auth
+	Keys     *keystore.KeyStore
+	Policy   *auth.Policy
+	Hasher   password.Hasher
 	Teardown func()
 
 	t *testing.T
@@ -123,7 +128,8 @@ func NewIntegration(t *testing.T, dbc DBContainer) *Test {
 	}
 
 	// Build an authenticator using this private key and id for the key store.
-	auth, err := auth.New(keyID, keystore.NewMap(map[string]*rsa.PrivateKey{keyID: privateKey}))
+	ks := keystore.NewMap(map[string]crypto.Signer{keyID: privateKey})
+	a, err := auth.New(keyID, ks)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -131,7 +137,10 @@ func NewIntegration(t *testing.T, dbc DBContainer) *Test {
 	test := Test{
 		DB:       db,
 		Log:      log,
-		Auth:     auth,
+		Auth:     a,
+		Keys:     ks,
+		Policy:   auth.DefaultPolicy(),
+		Hasher:   password.Default(password.DefaultParams),
 		t:        t,
 		Teardown: teardown,
 	}
@@ -143,7 +152,7 @@ func NewIntegration(t *testing.T, dbc DBContainer) *Test {
 func (test *Test) Token(email, pass string) string {
 	test.t.Log("Generating token for test ...")
 
-	store := user.NewStore(test.Log, test.DB)
+	store := user.NewStore(test.Log, test.DB, test.Policy, test.Hasher)
 	claims, err := store.Authenticate(context.Background(), time.Now(), email, pass)
 	if err != nil {
 		test.t.Fatal(err)
@@ -1,9 +1,15 @@
 package auth
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
@@ -12,34 +18,109 @@ import (
 var ErrForbidden = errors.New("attempted action is not allowed")
 
 // KeyLookup declares a method set of behavior for looking up
-// private and public keys for JWT use.
+// private and public keys for JWT use. The type of the key decides the
+// algorithm used to sign and validate tokens.
 type KeyLookup interface {
-	PrivateKey(kid string) (*rsa.PrivateKey, error)
-	PublicKey(kid string) (*rsa.PublicKey, error)
+	PrivateKey(kid string) (crypto.Signer, error)
+	PublicKey(kid string) (crypto.PublicKey, error)
 }
+
+// ActiveKeyLookup is implemented by key lookups that need to know the key
+// signing new tokens, so they can refuse to retire it.
+type ActiveKeyLookup interface {
+	SetActive(kid string) error
+}
+
+// Source represents an issuer, like a corporate identity provider, whose
+// tokens are accepted alongside the ones we sign. Tokens carrying the issuer
+// are validated with the keys of the source and must be meant for the
+// audience when one is set. The roles are granted to every token of the
+// source, roles carried by the tokens are ignored since the source doesn't
+// know ours.
+type Source struct {
+	Issuer   string
+	Audience string
+	Keys     KeyLookup
+	Roles    []string
+}
+
+// Option represents a function that can configure an Auth.
+type Option func(a *Auth)
+
+// WithIssuer sets the issuer stamped on the tokens we generate. Tokens that
+// are not issued by a trusted source must carry this issuer.
+func WithIssuer(issuer string) Option {
+	return func(a *Auth) {
+		a.issuer = issuer
+	}
+}
+
+// WithAudience sets the audience stamped on the tokens we generate when
+// they don't specify one. Tokens that are not issued by a trusted source
+// must be meant for this audience.
+func WithAudience(audience string) Option {
+	return func(a *Auth) {
+		a.audience = audience
+	}
+}
+
+// WithLeeway sets the amount of clock skew allowed when validating the time
+// based claims of a token.
+func WithLeeway(leeway time.Duration) Option {
+	return func(a *Auth) {
+		a.leeway = leeway
+	}
+}
+
+// WithTrustedSource accepts tokens issued by the specified source.
+func WithTrustedSource(src Source) Option {
+	return func(a *Auth) {
+		a.sources[src.Issuer] = src
+	}
+}
+
 // Auth is used to authenticate clients. It can generate a token for a
-// set of user claims and recreate the claims by parsing the token.
+// set of user claims and recreate the claims by parsing the token. The
+// active KID can be switched at runtime to rotate the signing key.
 type Auth struct {
+	mu        sync.RWMutex
 	activeKID string
 	keyLookup KeyLookup
-	method    jwt.SigningMethod
+	issuer    string
+	audience  string
+	leeway    time.Duration
+	sources   map[string]Source
 	keyFunc   func(t *jwt.Token) (interface{}, error)
 	parser    *jwt.Parser
 }
+
 // New creates an Auth to support authentication/authorization.
-func New(activeKID string, keyLookup KeyLookup) (*Auth, error) {
+func New(activeKID string, keyLookup KeyLookup, opts ...Option) (*Auth, error) {
 	// The activeKID represents the private key used to signed new tokens.
-	_, err := keyLookup.PrivateKey(activeKID)
-	if err != nil {
-		return nil, errors.New("active KID does not exist in store")
+	if err := activate(keyLookup, activeKID); err != nil {
+		return nil, err
 	}
 
-	method := jwt.GetSigningMethod("RS256")
-	if method == nil {
-		return nil, errors.New("configuring algorithm RS256")
+	a := Auth{
+		activeKID: activeKID,
+		keyLookup: keyLookup,
+		sources:   make(map[string]Source),
 	}
 
-	keyFunc := func(t *jwt.Token) (interface{}, error) {
+	for _, opt := range opts {
+		opt(&a)
+	}
+
+	for issuer, src := range a.sources {
+		if src.Keys == nil {
+			return nil, fmt.Errorf("trusted source %q has no keys", issuer)
+		}
+		if issuer == a.issuer {
+			return nil, fmt.Errorf("trusted source %q uses our issuer", issuer)
+		}
+	}
+
+	a.keyFunc = func(t *jwt.Token) (interface{}, error) {
 		kid, ok := t.Header["kid"]
 		if !ok {
 			return nil, errors.New("missing key id (kid) in token header")
@@ -48,35 +129,103 @@ func New(activeKID string, keyLookup KeyLookup) (*Auth, error) {
 		if !ok {
 			return nil, errors.New("user token key id (kid) must be string")
 		}
-		return keyLookup.PublicKey(kidID)
+
+		// Tokens of a trusted source are validated with the keys of the
+		// source and must be meant for us.
+		keys := a.keyLookup
+		if claims, ok := t.Claims.(*Claims); ok {
+			if src, exists := a.sources[claims.Issuer]; exists {
+				if src.Audience != "" && !claims.VerifyAudience(src.Audience, true) {
+					return nil, fmt.Errorf("token is not meant for audience %q", src.Audience)
+				}
+				keys = src.Keys
+			}
+		}
+
+		publicKey, err := keys.PublicKey(kidID)
+		if err != nil {
+			return nil, err
+		}
+
+		// The algorithm in the header must be the one that belongs to the
+		// key, otherwise a token could be validated with the wrong method.
+		method, err := signingMethod(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("algorithm %s does not match key id (kid) %s", t.Method.Alg(), kidID)
+		}
+
+		return publicKey, nil
 	}
 
 	// Create the token parser to use. The algorithm used to sign the JWT must be
 	// validated to avoid a critical vulnerability:
 	// https://auth0.com/blog/critical-vulnerabilities-in-json-web-token-libraries/
-	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256"}))
+	// The claims are validated by us so the leeway can be applied.
+	a.parser = jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithoutClaimsValidation(),
+	)
 
-	a := Auth{
-		activeKID: activeKID,
-		keyLookup: keyLookup,
-		method:    method,
-		keyFunc:   keyFunc,
-		parser:    parser,
+	return &a, nil
+}
+
+// External returns true if the claims were issued by a trusted source
+// instead of by us.
+func (a *Auth) External(claims Claims) bool {
+	_, exists := a.sources[claims.Issuer]
+	return exists
+}
+
+// ActiveKID returns the KID of the private key used to sign new tokens.
+func (a *Auth) ActiveKID() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.activeKID
+}
+
+// SetActiveKID switches the private key used to sign new tokens. Tokens
+// signed with the previous key continue to validate as long as the key
+// lookup can find its public key.
+func (a *Auth) SetActiveKID(activeKID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := activate(a.keyLookup, activeKID); err != nil {
+		return err
 	}
 
-	return &a, nil
+	a.activeKID = activeKID
+	return nil
 }
 
 // GenerateToken generates a signed JWT token string representing the user Claims.
 func (a *Auth) GenerateToken(claims Claims) (string, error) {
-	token := jwt.NewWithClaims(a.method, claims)
-	token.Header["kid"] = a.activeKID
+	activeKID := a.ActiveKID()
+
+	if a.issuer != "" {
+		claims.Issuer = a.issuer
+	}
+	if a.audience != "" && len(claims.Audience) == 0 {
+		claims.Audience = jwt.ClaimStrings{a.audience}
+	}
 
-	privateKey, err := a.keyLookup.PrivateKey(a.activeKID)
+	privateKey, err := a.keyLookup.PrivateKey(activeKID)
 	if err != nil {
 		return "", errors.New("kid lookup failed")
 	}
 
+	method, err := signingMethod(privateKey.Public())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = activeKID
+
 	str, err := token.SignedString(privateKey)
 	if err != nil {
 		return "", fmt.Errorf("signing token: %w", err)
@@ -98,5 +247,101 @@ func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
 		return Claims{}, errors.New("invalid token")
 	}
 
+	if err := a.validateClaims(&claims, time.Now()); err != nil {
+		return Claims{}, err
+	}
+
+	if src, exists := a.sources[claims.Issuer]; exists {
+		claims = external(src, claims)
+	}
+
 	return claims, nil
-}
\ No newline at end of file
+}
+
+// validateClaims verifies the time based claims allowing for the leeway and
+// that our tokens carry the expected issuer and audience. The audience of a
+// trusted source was verified when its keys were looked up. Tokens of a
+// trusted source must expire, we can't revoke them.
+func (a *Auth) validateClaims(claims *Claims, now time.Time) error {
+	if !claims.VerifyExpiresAt(now.Add(-a.leeway), a.External(*claims)) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now.Add(a.leeway), false) {
+		return errors.New("token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now.Add(a.leeway), false) {
+		return errors.New("token used before issued")
+	}
+
+	if a.External(*claims) {
+		return nil
+	}
+
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return fmt.Errorf("token issuer %q is not trusted", claims.Issuer)
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return fmt.Errorf("token is not meant for audience %q", a.audience)
+	}
+
+	return nil
+}
+
+// external adapts the claims of a trusted source to our model. The tokens
+// get the roles configured for the source and scopes that are not one of our
+// permissions are dropped.
+func external(src Source, claims Claims) Claims {
+	claims.Roles = src.Roles
+
+	known := make(map[string]bool)
+	for _, perm := range Permissions() {
+		known[perm] = true
+	}
+
+	var scopes []string
+	for _, scope := range claims.Scopes() {
+		if known[scope] {
+			scopes = append(scopes, scope)
+		}
+	}
+	claims.Scope = strings.Join(scopes, " ")
+
+	return claims
+}
+
+// signingMethod returns the signing method to use with the specified key.
+func signingMethod(publicKey crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch pk := publicKey.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PublicKey:
+		switch pk.Curve.Params().BitSize {
+		case 256:
+			return jwt.SigningMethodES256, nil
+		case 384:
+			return jwt.SigningMethodES384, nil
+		case 521:
+			return jwt.SigningMethodES512, nil
+		}
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+// activate checks the key can sign tokens and tells the key lookup it is
+// now the active key when the lookup wants to know.
+func activate(keyLookup KeyLookup, activeKID string) error {
+	if _, err := keyLookup.PrivateKey(activeKID); err != nil {
+		return errors.New("active KID does not exist in store")
+	}
+
+	if akl, ok := keyLookup.(ActiveKeyLookup); ok {
+		if err := akl.SetActive(activeKID); err != nil {
+			return fmt.Errorf("activating key: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -1,12 +1,23 @@
 package auth_test
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"github.com/asishcse60/service/business/sys/auth"
-	"github.com/golang-jwt/jwt/v4"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/foundation/keystore"
 )
 
 // Success and failure markers.
@@ -72,16 +83,510 @@ func TestAuth(t *testing.T) {
 		}
 	}
 }
+
+func TestAlgorithms(t *testing.T) {
+	ec256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create a P-256 key: %v", err)
+	}
+	ec384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create a P-384 key: %v", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create an Ed25519 key: %v", err)
+	}
+
+	tt := []struct {
+		name string
+		pk   crypto.Signer
+		alg  string
+	}{
+		{"ES256", ec256, "ES256"},
+		{"ES384", ec384, "ES384"},
+		{"EdDSA", ed, "EdDSA"},
+	}
+
+	t.Log("Given the need to sign tokens based on the type of key.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen handling a %s key.", testID, tst.name)
+			{
+				const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+				a, err := auth.New(keyID, &keyStore{pk: tst.pk})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to create an authenticator.", success, testID)
+
+				claims := auth.Claims{
+					RegisteredClaims: jwt.RegisteredClaims{
+						Subject:   "5cf37266-3473-4006-984f-9325122678b7",
+						ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
+						IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+					},
+					Roles: []string{auth.RoleAdmin},
+				}
+
+				token, err := a.GenerateToken(claims)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to generate a JWT.", success, testID)
+
+				parsed, _, err := jwt.NewParser().ParseUnverified(token, &auth.Claims{})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to parse the JWT: %v", failed, testID, err)
+				}
+				if parsed.Method.Alg() != tst.alg {
+					t.Fatalf("\t%s\tTest %d:\tShould be signed with %s: %s", failed, testID, tst.alg, parsed.Method.Alg())
+				}
+				t.Logf("\t%s\tTest %d:\tShould be signed with %s.", success, testID, tst.alg)
+
+				if _, err := a.ValidateToken(token); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to validate the JWT: %v", failed, testID, err)
+				}
+				t.Logf("\t%s\tTest %d:\tShould be able to validate the JWT.", success, testID)
+
+				// Validate the token against a key of another type stored under
+				// the same kid.
+				other, err := auth.New(keyID, &keyStore{pk: ec384})
+				if tst.pk == ec384 {
+					other, err = auth.New(keyID, &keyStore{pk: ec256})
+				}
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create an authenticator: %v", failed, testID, err)
+				}
+				if _, err := other.ValidateToken(token); err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould not validate the JWT with a different key.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould not validate the JWT with a different key.", success, testID)
+			}
+		}
+	}
+}
+
+func TestTrustedSource(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	const audience = "sales-api"
+
+	idpKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create the identity provider key: %v", err)
+	}
+
+	// Serve the key set of the identity provider. The key is only published
+	// once rotated is set to simulate a key the provider added later.
+	var rotated bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks := keystore.JWKS{Keys: []keystore.JWK{}}
+		if rotated {
+			jwk, err := keystore.NewJWK("idp-key", idpKey.Public())
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+
+	localKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Should be able to create the local key: %v", err)
+	}
+
+	src := auth.Source{
+		Issuer:   issuer,
+		Audience: audience,
+		Keys:     keystore.NewRemote(srv.URL, keystore.WithMinRefresh(0)),
+		Roles:    []string{auth.RoleUser},
+	}
+	a, err := auth.New("local-key", &keyStore{pk: localKey}, auth.WithTrustedSource(src))
+	if err != nil {
+		t.Fatalf("Should be able to create an authenticator: %v", err)
+	}
+
+	expires := jwt.NewNumericDate(time.Now().UTC().Add(time.Hour))
+	sign := func(aud string, exp *jwt.NumericDate) string {
+		claims := auth.Claims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   "corp|12345",
+				Audience:  jwt.ClaimStrings{aud},
+				ExpiresAt: exp,
+				IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+			},
+			Roles: []string{auth.RoleAdmin},
+			Scope: "openid profile",
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = "idp-key"
+		str, err := token.SignedString(idpKey)
+		if err != nil {
+			t.Fatalf("Should be able to sign the token: %v", err)
+		}
+		return str
+	}
+
+	t.Log("Given the need to accept tokens of a trusted identity provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the provider signs with a key it publishes later.", testID)
+		{
+			if _, err := a.ValidateToken(sign(audience, expires)); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not validate the token before the key is published.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not validate the token before the key is published.", success, testID)
+
+			rotated = true
+
+			claims, err := a.ValidateToken(sign(audience, expires))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the token: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate the token.", success, testID)
+
+			if !a.External(claims) {
+				t.Fatalf("\t%s\tTest %d:\tShould identify the claims as external.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould identify the claims as external.", success, testID)
+
+			if len(claims.Roles) != 1 || claims.Roles[0] != auth.RoleUser {
+				t.Fatalf("\t%s\tTest %d:\tShould only grant the roles of the source: %v", failed, testID, claims.Roles)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only grant the roles of the source.", success, testID)
+
+			if claims.Scope != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould drop scopes that are not permissions: %q", failed, testID, claims.Scope)
+			}
+			t.Logf("\t%s\tTest %d:\tShould drop scopes that are not permissions.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the token is meant for another audience.", testID)
+		{
+			if _, err := a.ValidateToken(sign("billing-api", expires)); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not validate the token.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not validate the token.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a local token claims to be from the provider.", testID)
+		{
+			claims := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    issuer,
+					Audience:  jwt.ClaimStrings{audience},
+					ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(time.Hour)),
+				},
+			}
+			token, err := a.GenerateToken(claims)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+			}
+			if _, err := a.ValidateToken(token); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not validate the token.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not validate the token.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the token of the provider doesn't expire.", testID)
+		{
+			if _, err := a.ValidateToken(sign(audience, nil)); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not validate the token.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not validate the token.", success, testID)
+		}
+	}
+}
+
+func TestClaimsValidation(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create a private key: %v", err)
+	}
+	ks := &keyStore{pk: privateKey}
+
+	a, err := auth.New("kid", ks, auth.WithIssuer("sales"), auth.WithAudience("sales-api"), auth.WithLeeway(time.Minute))
+	if err != nil {
+		t.Fatalf("Should be able to create an authenticator: %v", err)
+	}
+
+	tt := []struct {
+		name   string
+		gen    *auth.Auth
+		claims jwt.RegisteredClaims
+		valid  bool
+	}{
+		{
+			name:   "stamped issuer and audience",
+			gen:    a,
+			claims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+			valid:  true,
+		},
+		{
+			name:   "expired within the leeway",
+			gen:    a,
+			claims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-30 * time.Second))},
+			valid:  true,
+		},
+		{
+			name:   "expired beyond the leeway",
+			gen:    a,
+			claims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-2 * time.Minute))},
+			valid:  false,
+		},
+		{
+			name:   "meant for another audience",
+			gen:    a,
+			claims: jwt.RegisteredClaims{Audience: jwt.ClaimStrings{"billing-api"}},
+			valid:  false,
+		},
+		{
+			name:   "issued by another service",
+			gen:    mustAuth(t, ks, auth.WithIssuer("billing"), auth.WithAudience("sales-api")),
+			claims: jwt.RegisteredClaims{},
+			valid:  false,
+		},
+	}
+
+	t.Log("Given the need to only accept tokens meant for this service.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen handling a token %s.", testID, tst.name)
+			{
+				token, err := tst.gen.GenerateToken(auth.Claims{RegisteredClaims: tst.claims})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a JWT: %v", failed, testID, err)
+				}
+
+				_, err = a.ValidateToken(token)
+				if tst.valid && err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould accept the token: %v", failed, testID, err)
+				}
+				if !tst.valid && err == nil {
+					t.Fatalf("\t%s\tTest %d:\tShould reject the token.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould decide on the token correctly.", success, testID)
+			}
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	t.Log("Given the need to authorize access based on permissions.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using the built-in roles.", testID)
+		{
+			const (
+				ownerID = "5cf37266-3473-4006-984f-9325122678b7"
+				otherID = "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"
+			)
+
+			policy := auth.DefaultPolicy()
+
+			admin := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: otherID},
+				Roles:            []string{auth.RoleAdmin},
+			}
+			user := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: ownerID},
+				Roles:            []string{auth.RoleUser},
+			}
+
+			if !policy.Permitted(admin, auth.PermProductDelete) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow an admin to delete products.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow an admin to delete products.", success, testID)
+
+			if policy.Permitted(user, auth.PermProductDelete) {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow a user to delete products.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow a user to delete products.", success, testID)
+
+			if !policy.PermittedOwner(user, ownerID, auth.PermUserReadAny, auth.PermUserReadOwn) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow a user to read themselves.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow a user to read themselves.", success, testID)
+
+			if policy.PermittedOwner(user, otherID, auth.PermUserReadAny, auth.PermUserReadOwn) {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow a user to read someone else.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow a user to read someone else.", success, testID)
+
+			policy.Load(map[string][]string{auth.RoleUser: {auth.PermProductDelete}})
+
+			if !policy.Permitted(user, auth.PermProductDelete) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow a user to delete products after a reload.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow a user to delete products after a reload.", success, testID)
+
+			if policy.Permitted(admin, auth.PermProductDelete) {
+				t.Fatalf("\t%s\tTest %d:\tShould not know the admin role after a reload.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not know the admin role after a reload.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen using a token restricted by a scope.", testID)
+		{
+			policy := auth.DefaultPolicy()
+
+			if _, err := policy.Scope([]string{auth.RoleUser}, []string{auth.PermProductDelete}); !errors.Is(err, auth.ErrInvalidScope) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to request a scope the roles do not grant: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to request a scope the roles do not grant.", success, testID)
+
+			scope, err := policy.Scope([]string{auth.RoleAdmin}, []string{auth.PermProductRead, auth.PermUserList})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request a scope the roles grant: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to request a scope the roles grant.", success, testID)
+
+			claims := auth.Claims{
+				Roles: []string{auth.RoleAdmin},
+				Scope: scope,
+			}
+
+			if !policy.Permitted(claims, auth.PermProductRead) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow a permission within the scope.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow a permission within the scope.", success, testID)
+
+			if policy.Permitted(claims, auth.PermProductDelete) {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow a permission outside the scope.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow a permission outside the scope.", success, testID)
+
+			if perms := policy.Effective(claims); len(perms) != 2 || perms[0] != auth.PermProductRead || perms[1] != auth.PermUserList {
+				t.Fatalf("\t%s\tTest %d:\tShould only have the permissions within the scope : %v", failed, testID, perms)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only have the permissions within the scope.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen an admin is impersonating a user.", testID)
+		{
+			policy := auth.DefaultPolicy()
+
+			claims := auth.Claims{
+				RegisteredClaims: jwt.RegisteredClaims{Subject: "5cf37266-3473-4006-984f-9325122678b7"},
+				Roles:            []string{auth.RoleAdmin},
+				Actor:            &auth.Actor{Subject: "45b5fbd3-755f-4379-8f07-a58d4a30fa2f"},
+			}
+
+			if !policy.Permitted(claims, auth.PermProductRead) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow reading while impersonating.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow reading while impersonating.", success, testID)
+
+			if policy.PermittedOwner(claims, claims.Subject, auth.PermUserDeleteAny, auth.PermUserDeleteOwn) {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow deleting while impersonating.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow deleting while impersonating.", success, testID)
+
+			if policy.PermittedOwner(claims, claims.Subject, auth.PermUserUpdateAny, auth.PermUserUpdateOwn) {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow updating users while impersonating.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow updating users while impersonating.", success, testID)
+
+			for _, perm := range policy.Effective(claims) {
+				if perm == auth.PermUserImpersonate {
+					t.Fatalf("\t%s\tTest %d:\tShould not be able to impersonate while impersonating.", failed, testID)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to impersonate while impersonating.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen handing out roles.", testID)
+		{
+			policy := auth.NewPolicy(map[string][]string{
+				auth.RoleAdmin: auth.Permissions(),
+				auth.RoleUser:  {auth.PermProductRead},
+				"SUPPORT":      {auth.PermUserCreate, auth.PermUserUpdateAny, auth.PermProductRead},
+			})
+
+			support := auth.Claims{Roles: []string{"SUPPORT"}}
+
+			if !policy.Grantable(support, auth.RoleUser) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hand out a role granting less.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to hand out a role granting less.", success, testID)
+
+			if policy.Grantable(support, auth.RoleUser, auth.RoleAdmin) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to hand out a role granting more.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to hand out a role granting more.", success, testID)
+		}
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	t.Log("Given the need to protect sessions against cross site request forgery.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen checking the csrf token of a session.", testID)
+		{
+			csrf, err := auth.NewCSRFToken()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a csrf token: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a csrf token.", success, testID)
+
+			claims := auth.Claims{CSRF: csrf}
+
+			if !auth.CheckCSRF(claims, csrf, csrf) {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a matching header and cookie.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a matching header and cookie.", success, testID)
+
+			if auth.CheckCSRF(claims, "", csrf) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a missing header.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a missing header.", success, testID)
+
+			other, err := auth.NewCSRFToken()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a csrf token: %v", failed, testID, err)
+			}
+			if auth.CheckCSRF(claims, other, other) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a token not bound to the session.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a token not bound to the session.", success, testID)
+
+			if auth.CheckCSRF(auth.Claims{}, "", "") {
+				t.Fatalf("\t%s\tTest %d:\tShould reject claims without a session.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject claims without a session.", success, testID)
+		}
+	}
+}
+
 // =============================================================================
 
 type keyStore struct {
-	pk *rsa.PrivateKey
+	pk crypto.Signer
 }
 
-func (ks *keyStore) PrivateKey(kid string) (*rsa.PrivateKey, error) {
+func (ks *keyStore) PrivateKey(kid string) (crypto.Signer, error) {
 	return ks.pk, nil
 }
 
-func (ks *keyStore) PublicKey(kid string) (*rsa.PublicKey, error) {
-	return &ks.pk.PublicKey, nil
+func (ks *keyStore) PublicKey(kid string) (crypto.PublicKey, error) {
+	return ks.pk.Public(), nil
+}
+
+func mustAuth(t *testing.T, ks auth.KeyLookup, opts ...auth.Option) *auth.Auth {
+	a, err := auth.New("kid", ks, opts...)
+	if err != nil {
+		t.Fatalf("Should be able to create an authenticator: %v", err)
+	}
+	return a
 }
\ No newline at end of file
@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v4"
 )
@@ -13,10 +14,73 @@ const (
 	RoleUser  = "USER"
 )
 
-// Claims represents the authorization claims transmitted via a JWT.
+// ErrRevoked is returned when the claims of a token are no longer valid for
+// the subject, for example because its roles changed after it was issued.
+var ErrRevoked = errors.New("token has been revoked")
+
+// Claims represents the authorization claims transmitted via a JWT. The
+// scope is an OAuth style space delimited list of permissions the token is
+// restricted to. A token without a scope is restricted by its roles only.
+// The version must match the current token version of the subject for the
+// token to be accepted. The actor is set when the token was issued to an
+// admin acting as the subject. The CSRF token is only set for the tokens
+// carried by a session cookie.
 type Claims struct {
 	jwt.RegisteredClaims
-	Roles []string `json:"roles"`
+	Roles   []string `json:"roles"`
+	Scope   string   `json:"scope,omitempty"`
+	Version int      `json:"ver,omitempty"`
+	Actor   *Actor   `json:"act,omitempty"`
+	CSRF    string   `json:"csrf,omitempty"`
+}
+
+// Actor identifies the party acting on behalf of the subject of the claims
+// as defined by RFC 8693. The version is the token version of the actor when
+// the claims were issued so the claims are revoked along with its tokens.
+type Actor struct {
+	Subject string `json:"sub"`
+	Version int    `json:"ver,omitempty"`
+}
+
+// ClaimsChecker is implemented by types that can verify the claims of a
+// validated token are still current for its subject.
+type ClaimsChecker interface {
+	CheckClaims(ctx context.Context, claims Claims) error
+}
+
+// Impersonating returns true if the claims were issued to an actor acting
+// as the subject.
+func (c Claims) Impersonating() bool {
+	return c.Actor != nil
+}
+
+// ActorSubject returns the subject of the actor or an empty string when the
+// claims don't represent an impersonation.
+func (c Claims) ActorSubject() string {
+	if c.Actor == nil {
+		return ""
+	}
+	return c.Actor.Subject
+}
+
+// Scopes returns the list of permissions the claims are restricted to.
+func (c Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// InScope returns true if the claims are not restricted by a scope or the
+// scope contains the specified permission.
+func (c Claims) InScope(perm string) bool {
+	scopes := c.Scopes()
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope == perm {
+			return true
+		}
+	}
+	return false
 }
 
 // Authorized returns true if the claims has at least one of the provided roles.
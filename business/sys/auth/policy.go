@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidScope is returned when a requested scope is not granted by
+// the roles of a user.
+var ErrInvalidScope = errors.New("requested scope is not allowed")
+
+// These are the set of permissions a role can be granted. Permissions that
+// end in :any apply to every record, the ones ending in :own only apply to
+// records owned by the subject of the claims.
+const (
+	PermUserCreate       = "user:create"
+	PermUserList         = "user:list"
+	PermUserReadAny      = "user:read:any"
+	PermUserReadOwn      = "user:read:own"
+	PermUserUpdateAny    = "user:update:any"
+	PermUserUpdateOwn    = "user:update:own"
+	PermUserDeleteAny    = "user:delete:any"
+	PermUserDeleteOwn    = "user:delete:own"
+	PermProductCreate    = "product:create"
+	PermProductRead      = "product:read"
+	PermProductUpdateAny = "product:update:any"
+	PermProductUpdateOwn = "product:update:own"
+	PermProductDelete    = "product:delete"
+	PermRoleManage       = "role:manage"
+	PermKeyManage        = "key:manage"
+	PermTokenIntrospect  = "token:introspect"
+	PermUserImpersonate  = "user:impersonate"
+)
+
+// impersonationDenied is the set of destructive or privileged permissions
+// that can't be exercised while an admin is impersonating another user.
+// Updating users is denied too since it changes their roles, status and
+// password.
+var impersonationDenied = map[string]bool{
+	PermUserUpdateAny:   true,
+	PermUserUpdateOwn:   true,
+	PermUserDeleteAny:   true,
+	PermUserDeleteOwn:   true,
+	PermProductDelete:   true,
+	PermRoleManage:      true,
+	PermKeyManage:       true,
+	PermUserImpersonate: true,
+}
+
+// Permissions returns the full set of known permissions.
+func Permissions() []string {
+	return []string{
+		PermUserCreate,
+		PermUserList,
+		PermUserReadAny,
+		PermUserReadOwn,
+		PermUserUpdateAny,
+		PermUserUpdateOwn,
+		PermUserDeleteAny,
+		PermUserDeleteOwn,
+		PermProductCreate,
+		PermProductRead,
+		PermProductUpdateAny,
+		PermProductUpdateOwn,
+		PermProductDelete,
+		PermRoleManage,
+		PermKeyManage,
+		PermTokenIntrospect,
+		PermUserImpersonate,
+	}
+}
+
+// DefaultRoles returns the permissions granted to the built-in roles when no
+// other configuration is available.
+func DefaultRoles() map[string][]string {
+	return map[string][]string{
+		RoleAdmin: Permissions(),
+		RoleUser: {
+			PermUserReadOwn,
+			PermProductCreate,
+			PermProductRead,
+			PermProductUpdateOwn,
+		},
+	}
+}
+
+// Policy maps roles to the permissions they grant. It is safe for concurrent
+// use so the set of roles can be reloaded while requests are being served.
+type Policy struct {
+	mu    sync.RWMutex
+	roles map[string]map[string]struct{}
+}
+
+// NewPolicy constructs a Policy from a map of role names to permissions.
+func NewPolicy(roles map[string][]string) *Policy {
+	var p Policy
+	p.Load(roles)
+	return &p
+}
+
+// DefaultPolicy constructs a Policy based on the built-in roles.
+func DefaultPolicy() *Policy {
+	return NewPolicy(DefaultRoles())
+}
+
+// Load replaces the full set of roles managed by the policy.
+func (p *Policy) Load(roles map[string][]string) {
+	m := make(map[string]map[string]struct{}, len(roles))
+	for role, perms := range roles {
+		set := make(map[string]struct{}, len(perms))
+		for _, perm := range perms {
+			set[perm] = struct{}{}
+		}
+		m[role] = set
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.roles = m
+}
+
+// Permissions returns the sorted set of permissions granted by the
+// specified roles.
+func (p *Policy) Permissions(roles ...string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	set := make(map[string]struct{})
+	for _, role := range roles {
+		for perm := range p.roles[role] {
+			set[perm] = struct{}{}
+		}
+	}
+
+	perms := make([]string, 0, len(set))
+	for perm := range set {
+		perms = append(perms, perm)
+	}
+	sort.Strings(perms)
+
+	return perms
+}
+
+// Effective returns the sorted set of permissions the claims can exercise,
+// which are the permissions granted by the roles limited to the scope.
+func (p *Policy) Effective(claims Claims) []string {
+	var perms []string
+	for _, perm := range p.Permissions(claims.Roles...) {
+		if usable(claims, perm) {
+			perms = append(perms, perm)
+		}
+	}
+	return perms
+}
+
+// Scope validates the requested scopes against the permissions granted by
+// the roles and returns the value to use for the scope claim. No requested
+// scopes results in an unrestricted token.
+func (p *Policy) Scope(roles []string, requested []string) (string, error) {
+	granted := make(map[string]bool)
+	for _, perm := range p.Permissions(roles...) {
+		granted[perm] = true
+	}
+
+	for _, scope := range requested {
+		if !granted[scope] {
+			return "", fmt.Errorf("scope[%s]: %w", scope, ErrInvalidScope)
+		}
+	}
+
+	return strings.Join(requested, " "), nil
+}
+
+// Permitted returns true if the roles in the claims grant at least one of
+// the provided permissions and that permission is within the scope of
+// the claims. Destructive permissions are never granted while impersonating.
+func (p *Policy) Permitted(claims Claims, perms ...string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, role := range claims.Roles {
+		for _, perm := range perms {
+			if _, exists := p.roles[role][perm]; exists && usable(claims, perm) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PermittedOwner returns true if the claims are granted the anyPerm
+// permission, or the ownPerm permission and the subject of the claims is
+// the owner of the record.
+func (p *Policy) PermittedOwner(claims Claims, ownerID string, anyPerm string, ownPerm string) bool {
+	if p.Permitted(claims, anyPerm) {
+		return true
+	}
+	return claims.Subject == ownerID && p.Permitted(claims, ownPerm)
+}
+
+// Grantable returns true if the claims are permitted every permission the
+// roles grant, so a caller can only hand out roles that don't give anyone
+// more than the caller has.
+func (p *Policy) Grantable(claims Claims, roles ...string) bool {
+	for _, perm := range p.Permissions(roles...) {
+		if !p.Permitted(claims, perm) {
+			return false
+		}
+	}
+	return true
+}
+
+// usable returns true if the permission is within the scope of the claims
+// and is not denied because the claims represent an impersonation.
+func usable(claims Claims, perm string) bool {
+	if claims.Impersonating() && impersonationDenied[perm] {
+		return false
+	}
+	return claims.InScope(perm)
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+)
+
+// These are the names used to carry a session between a browser and the
+// service. The session cookie holds the token and can't be read by scripts.
+// The CSRF cookie can be read by scripts so the value can be echoed in the
+// CSRF header of unsafe requests.
+const (
+	SessionCookie = "session"
+	CSRFCookie    = "csrf"
+	CSRFHeader    = "X-CSRF-Token"
+)
+
+// NewCSRFToken returns a random token used to protect a session against
+// cross site request forgery.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating csrf token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CheckCSRF returns true if the token sent in the CSRF header matches both
+// the CSRF cookie and the token bound to the claims of the session.
+func CheckCSRF(claims Claims, header string, cookie string) bool {
+	if claims.CSRF == "" || header == "" {
+		return false
+	}
+
+	h := []byte(header)
+	return subtle.ConstantTimeCompare(h, []byte(cookie)) == 1 &&
+		subtle.ConstantTimeCompare(h, []byte(claims.CSRF)) == 1
+}
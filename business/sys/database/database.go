@@ -3,6 +3,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"go.opentelemetry.io/otel"
@@ -13,7 +14,7 @@ import (
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // Calls init function.
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 
 	"github.com/asishcse60/service/foundation/web"
@@ -25,8 +26,14 @@ var (
 	ErrInvalidID             = errors.New("ID is not in its proper form")
 	ErrAuthenticationFailure = errors.New("authentication failed")
 	ErrForbidden             = errors.New("attempted action is not allowed")
+	ErrAccountSuspended      = errors.New("account is suspended")
+	ErrDuplicate             = errors.New("duplicate entry")
 )
 
+// uniqueViolation is the postgres error code returned when a row would break
+// a unique constraint.
+const uniqueViolation = "23505"
+
 // Config is the required properties to use the database.
 type Config struct {
 	User         string
@@ -98,7 +105,7 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 
 // Transactor interface needed to begin transaction.
 type Transactor interface {
-	Beginx() (*sqlx.Tx, error)
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error)
 }
 
 // WithinTran runs passed function and do commit/rollback at the end.
@@ -107,7 +114,7 @@ func WithinTran(ctx context.Context, log *zap.SugaredLogger, db Transactor, fn f
 
 	// Begin the transaction.
 	log.Infow("begin tran", "traceid", traceID)
-	tx, err := db.Beginx()
+	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin tran: %w", err)
 	}
@@ -156,6 +163,10 @@ func NamedExecContext(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtCo
 	defer span.End()
 
 	if _, err := sqlx.NamedExecContext(ctx, db, query, data); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return fmt.Errorf("%w: %s", ErrDuplicate, pqErr.Message)
+		}
 		return err
 	}
 
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// Rows iterates over the result of a query one row at a time so large
+// collections don't have to be held in memory. Rows are only read from the
+// connection as the caller asks for them, and reading stops with the error
+// of the context once it is cancelled.
+type Rows struct {
+	rows *sqlx.Rows
+	span trace.Span
+}
+
+// NamedQueryRows is a helper function for executing queries that return a
+// collection of data to be read one row at a time. The caller must close
+// the returned rows.
+func NamedQueryRows(ctx context.Context, log *zap.SugaredLogger, db sqlx.ExtContext, query string, data interface{}) (*Rows, error) {
+	q := queryString(query, data)
+	log.Infow("database.NamedQueryRows", "traceid", web.GetTraceID(ctx), "query", q)
+
+	ctx, span := otel.GetTracerProvider().Tracer("").Start(ctx, "database.query")
+	span.SetAttributes(attribute.String("query", q))
+
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, data)
+	if err != nil {
+		span.End()
+		return nil, err
+	}
+
+	return &Rows{rows: rows, span: span}, nil
+}
+
+// Next unmarshals the next row into the struct. It returns io.EOF when there
+// are no more rows.
+func (r *Rows) Next(dest interface{}) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	return r.rows.StructScan(dest)
+}
+
+// Close releases the connection held by the rows. It is safe to call more
+// than once.
+func (r *Rows) Close() error {
+	defer r.span.End()
+	return r.rows.Close()
+}
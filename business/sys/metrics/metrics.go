@@ -4,6 +4,7 @@ import (
 	"context"
 	"expvar"
 	"runtime"
+	"time"
 )
 
 // This holds the single instance of the metrics value needed for
@@ -17,10 +18,14 @@ var m *metrics
 // metrics represents the set of metrics we gather. These fields are
 // safe to be accessed concurrently thanks to expvar. No extra abstraction is required.
 type metrics struct {
-	goroutines *expvar.Int
-	requests   *expvar.Int
-	errors     *expvar.Int
-	panics     *expvar.Int
+	goroutines    *expvar.Int
+	requests      *expvar.Int
+	errors        *expvar.Int
+	panics        *expvar.Int
+	timeouts      *expvar.Int
+	hashQueue     *expvar.Int
+	hashLatency   *expvar.Int
+	hashSaturated *expvar.Int
 }
 
 // init constructs the metrics value that will be used to capture metrics.
@@ -29,10 +34,14 @@ type metrics struct {
 // sure this initialization only happens once.
 func init() {
 	m = &metrics{
-		goroutines: expvar.NewInt("goroutines"),
-		requests:   expvar.NewInt("requests"),
-		errors:     expvar.NewInt("errors"),
-		panics:     expvar.NewInt("panics"),
+		goroutines:    expvar.NewInt("goroutines"),
+		requests:      expvar.NewInt("requests"),
+		errors:        expvar.NewInt("errors"),
+		panics:        expvar.NewInt("panics"),
+		timeouts:      expvar.NewInt("timeouts"),
+		hashQueue:     expvar.NewInt("hash_queue"),
+		hashLatency:   expvar.NewInt("hash_latency_ms"),
+		hashSaturated: expvar.NewInt("hash_saturated"),
 	}
 }
 
@@ -85,4 +94,35 @@ func AddPanics(ctx context.Context) {
 	if v, ok := ctx.Value(key).(*metrics); ok {
 		v.panics.Add(1)
 	}
-}
\ No newline at end of file
+}
+
+// AddTimeouts increments the metric for requests which didn't complete
+// before their deadline.
+func AddTimeouts(ctx context.Context) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.timeouts.Add(1)
+	}
+}
+
+// SetHashQueue sets the number of password hashing jobs waiting in the queue.
+func SetHashQueue(ctx context.Context, depth int) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.hashQueue.Set(int64(depth))
+	}
+}
+
+// SetHashLatency sets the time the last password hashing job took from
+// being queued to being completed.
+func SetHashLatency(ctx context.Context, latency time.Duration) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.hashLatency.Set(latency.Milliseconds())
+	}
+}
+
+// AddHashSaturated increments the metric for password hashing jobs that were
+// rejected because the queue was full.
+func AddHashSaturated(ctx context.Context) {
+	if v, ok := ctx.Value(key).(*metrics); ok {
+		v.hashSaturated.Add(1)
+	}
+}
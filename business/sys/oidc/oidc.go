@@ -0,0 +1,299 @@
+// Package oidc provides support for logging users in through an OpenID
+// Connect provider using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/asishcse60/service/foundation/keystore"
+)
+
+// Config represents the registration of the service with the provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity represents the user authenticated by the provider.
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Option represents a function that can configure a Provider.
+type Option func(p *Provider)
+
+// WithHTTPClient sets the client used to talk to the provider.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *Provider) {
+		p.client = client
+	}
+}
+
+// Provider represents an OpenID Connect provider users can log in with. The
+// endpoints are discovered from the issuer and the ID tokens are validated
+// with the keys the provider publishes.
+type Provider struct {
+	cfg      Config
+	client   *http.Client
+	authURL  string
+	tokenURL string
+	keys     *keystore.Remote
+	parser   *jwt.Parser
+}
+
+// New constructs a Provider by fetching the discovery document of the issuer.
+func New(ctx context.Context, cfg Config, opts ...Option) (*Provider, error) {
+	p := Provider{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "ES256", "ES384", "ES512", "EdDSA"})),
+	}
+
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	if len(p.cfg.Scopes) == 0 {
+		p.cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	var doc struct {
+		Issuer   string `json:"issuer"`
+		AuthURL  string `json:"authorization_endpoint"`
+		TokenURL string `json:"token_endpoint"`
+		JWKSURI  string `json:"jwks_uri"`
+	}
+
+	discovery := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.get(ctx, discovery, &doc); err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+
+	if doc.Issuer != cfg.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", doc.Issuer, cfg.Issuer)
+	}
+	if doc.AuthURL == "" || doc.TokenURL == "" || doc.JWKSURI == "" {
+		return nil, errors.New("provider discovery document is incomplete")
+	}
+
+	p.authURL = doc.AuthURL
+	p.tokenURL = doc.TokenURL
+	p.keys = keystore.NewRemote(doc.JWKSURI, keystore.WithHTTPClient(p.client))
+
+	return &p, nil
+}
+
+// AuthCodeURL returns the URL of the provider the user must be redirected to
+// in order to log in. The state and nonce are echoed back by the provider
+// and the challenge is derived from the PKCE verifier.
+func (p *Provider) AuthCodeURL(state string, nonce string, challenge string) string {
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+
+	return p.authURL + sep + v.Encode()
+}
+
+// Exchange trades the authorization code for an ID token and returns the
+// identity it carries. The verifier must be the one the challenge was
+// derived from and the nonce the one sent with the authorization request.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tkn struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&tkn); err != nil {
+		return Identity{}, fmt.Errorf("decoding token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("exchanging code: status %d: %s %s", resp.StatusCode, tkn.Error, tkn.ErrorDescription)
+	}
+	if tkn.IDToken == "" {
+		return Identity{}, errors.New("token response is missing the id token")
+	}
+
+	return p.verify(tkn.IDToken, nonce)
+}
+
+// verify validates the ID token was signed by the provider, was issued to
+// us and carries the nonce of the authorization request.
+func (p *Provider) verify(idToken string, nonce string) (Identity, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Nonce         string `json:"nonce"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, ok := t.Header["kid"].(string)
+		if !ok {
+			return nil, errors.New("missing key id (kid) in token header")
+		}
+
+		publicKey, err := p.keys.PublicKey(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matches(t.Method.Alg(), publicKey) {
+			return nil, fmt.Errorf("algorithm %s does not match key id (kid) %s", t.Method.Alg(), kid)
+		}
+
+		return publicKey, nil
+	}
+
+	if _, err := p.parser.ParseWithClaims(idToken, &claims, keyFunc); err != nil {
+		return Identity{}, fmt.Errorf("parsing id token: %w", err)
+	}
+
+	if !claims.VerifyIssuer(p.cfg.Issuer, true) {
+		return Identity{}, fmt.Errorf("id token issuer %q is not trusted", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.cfg.ClientID, true) {
+		return Identity{}, errors.New("id token was not issued to this client")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return Identity{}, errors.New("id token nonce does not match")
+	}
+	if claims.Subject == "" {
+		return Identity{}, errors.New("id token is missing the subject")
+	}
+
+	id := Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}
+
+	return id, nil
+}
+
+// get fetches and decodes a JSON document.
+func (p *Provider) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(v); err != nil {
+		return fmt.Errorf("decoding: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// NewPKCE returns a PKCE verifier and the S256 challenge derived from it as
+// defined by RFC 7636.
+func NewPKCE() (string, string, error) {
+	verifier, err := NewRandom()
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// NewRandom returns a random value suitable for a state or nonce.
+func NewRandom() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating random value: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// matches returns true if the algorithm can be used with the type of key.
+func matches(alg string, publicKey crypto.PublicKey) bool {
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
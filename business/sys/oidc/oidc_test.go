@@ -0,0 +1,276 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"github.com/asishcse60/service/business/sys/oidc"
+	"github.com/asishcse60/service/foundation/keystore"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+const (
+	clientID    = "sales-api"
+	redirectURL = "http://localhost:3000/v1/oidc/callback"
+	subject     = "idp|12345"
+)
+
+func TestLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	defer mock.Close()
+
+	ctx := context.Background()
+
+	p, err := oidc.New(ctx, oidc.Config{
+		Issuer:      mock.URL,
+		ClientID:    clientID,
+		RedirectURL: redirectURL,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to discover the provider: %v", err)
+	}
+
+	t.Log("Given the need to log users in through an OpenID Connect provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen completing the authorization code flow.", testID)
+		{
+			verifier, challenge, err := oidc.NewPKCE()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a PKCE verifier: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a PKCE verifier.", success, testID)
+
+			code, state := mock.authorize(t, p.AuthCodeURL("state-1", "nonce-1", challenge))
+			if state != "state-1" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the state : %s", failed, testID, state)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the state.", success, testID)
+
+			id, err := p.Exchange(ctx, code, verifier, "nonce-1")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to exchange the code: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to exchange the code.", success, testID)
+
+			if id.Issuer != mock.URL || id.Subject != subject || id.Email != "jill@example.com" || !id.EmailVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the identity of the user : %+v", failed, testID, id)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the identity of the user.", success, testID)
+
+			if _, err := p.Exchange(ctx, code, verifier, "nonce-1"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to use a code twice.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to use a code twice.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the PKCE verifier does not match the challenge.", testID)
+		{
+			_, challenge, err := oidc.NewPKCE()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a PKCE verifier: %v", failed, testID, err)
+			}
+			other, _, err := oidc.NewPKCE()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a PKCE verifier: %v", failed, testID, err)
+			}
+
+			code, _ := mock.authorize(t, p.AuthCodeURL("state-2", "nonce-2", challenge))
+			if _, err := p.Exchange(ctx, code, other, "nonce-2"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to exchange the code.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to exchange the code.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen the nonce does not match the request.", testID)
+		{
+			verifier, challenge, err := oidc.NewPKCE()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a PKCE verifier: %v", failed, testID, err)
+			}
+
+			code, _ := mock.authorize(t, p.AuthCodeURL("state-3", "nonce-3", challenge))
+			if _, err := p.Exchange(ctx, code, verifier, "replayed"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the id token.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the id token.", success, testID)
+		}
+	}
+}
+
+// =============================================================================
+
+// mockProvider is a local OpenID Connect provider that authorizes every
+// request for the same user.
+type mockProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Should be able to create the provider key: %v", err)
+	}
+
+	m := mockProvider{
+		key:   key,
+		codes: make(map[string]url.Values),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorizeHandler)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+
+	return &m
+}
+
+// authorize follows the authorization URL like a browser would and returns
+// the code and state the provider redirected back with.
+func (m *mockProvider) authorize(t *testing.T, authURL string) (string, string) {
+	client := http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Should be able to authorize: %v", err)
+	}
+	resp.Body.Close()
+
+	loc, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Should be redirected back: %v", err)
+	}
+
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func (m *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 m.URL,
+		"authorization_endpoint": m.URL + "/authorize",
+		"token_endpoint":         m.URL + "/token",
+		"jwks_uri":               m.URL + "/jwks",
+	})
+}
+
+func (m *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	jwk, err := keystore.NewJWK("idp-key", m.key.Public())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(keystore.JWKS{Keys: []keystore.JWK{jwk}})
+}
+
+func (m *mockProvider) authorizeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "unsupported request", http.StatusBadRequest)
+		return
+	}
+
+	code := base64.RawURLEncoding.EncodeToString([]byte(q.Get("state")))
+
+	m.mu.Lock()
+	m.codes[code] = q
+	m.mu.Unlock()
+
+	http.Redirect(w, r, q.Get("redirect_uri")+"?"+url.Values{"code": {code}, "state": {q.Get("state")}}.Encode(), http.StatusFound)
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	q, exists := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	fail := func(err error) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": err.Error()})
+	}
+
+	if !exists {
+		fail(errors.New("unknown code"))
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != q.Get("code_challenge") {
+		fail(errors.New("code verifier does not match"))
+		return
+	}
+	if r.PostForm.Get("client_id") != q.Get("client_id") || r.PostForm.Get("redirect_uri") != q.Get("redirect_uri") {
+		fail(errors.New("client does not match"))
+		return
+	}
+
+	claims := struct {
+		jwt.RegisteredClaims
+		Nonce         string `json:"nonce"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.URL,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{q.Get("client_id")},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		Nonce:         q.Get("nonce"),
+		Email:         "jill@example.com",
+		EmailVerified: true,
+		Name:          "Jill Walker",
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "idp-key"
+
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
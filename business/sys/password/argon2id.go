@@ -0,0 +1,136 @@
+package password
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2idPrefix identifies hashes produced by the Argon2id hasher.
+const argon2idPrefix = "$argon2id$"
+
+// Params represents the set of parameters used by argon2id.
+type Params struct {
+	Memory      uint32 // Amount of memory used in KiB.
+	Iterations  uint32 // Number of passes over the memory.
+	Parallelism uint8  // Number of threads used.
+	SaltLength  uint32 // Length of the random salt in bytes.
+	KeyLength   uint32 // Length of the generated key in bytes.
+}
+
+// DefaultParams represents the parameters recommended by OWASP for argon2id.
+var DefaultParams = Params{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Argon2id hashes passwords using argon2id. Hashes are encoded in the PHC
+// string format which records the parameters that were used.
+// Example: $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type Argon2id struct {
+	params Params
+}
+
+// NewArgon2id constructs an argon2id hasher using the specified parameters.
+func NewArgon2id(params Params) *Argon2id {
+	return &Argon2id{
+		params: params,
+	}
+}
+
+// Hash generates an encoded hash for the password with a random salt.
+func (a *Argon2id) Hash(ctx context.Context, password string) ([]byte, error) {
+	salt := make([]byte, a.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.params.Iterations, a.params.Memory, a.params.Parallelism, a.params.KeyLength)
+
+	hash := fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		a.params.Memory,
+		a.params.Iterations,
+		a.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(hash), nil
+}
+
+// Compare verifies the password against the hash using the parameters
+// recorded in the hash.
+func (a *Argon2id) Compare(ctx context.Context, hash []byte, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return ErrMismatch
+	}
+
+	return nil
+}
+
+// Identify returns true if the hash was produced by argon2id.
+func (a *Argon2id) Identify(hash []byte) bool {
+	return bytes.HasPrefix(hash, []byte(argon2idPrefix))
+}
+
+// NeedsRehash returns true if the parameters recorded in the hash are not
+// the parameters currently configured.
+func (a *Argon2id) NeedsRehash(hash []byte) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params != a.params
+}
+
+// decodeArgon2id parses an encoded argon2id hash.
+func decodeArgon2id(hash []byte) (Params, []byte, []byte, error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Params{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("parsing version: %w", err)
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Params{}, nil, nil, fmt.Errorf("parsing parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("decoding salt: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, fmt.Errorf("decoding key: %w", err)
+	}
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
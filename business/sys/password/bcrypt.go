@@ -0,0 +1,59 @@
+package password
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BcryptDefaultCost is the cost used for bcrypt hashes by default.
+const BcryptDefaultCost = bcrypt.DefaultCost
+
+// Bcrypt hashes passwords using bcrypt. It exists so hashes created before
+// argon2id became the default can still be verified.
+type Bcrypt struct {
+	cost int
+}
+
+// NewBcrypt constructs a bcrypt hasher using the specified cost.
+func NewBcrypt(cost int) *Bcrypt {
+	return &Bcrypt{
+		cost: cost,
+	}
+}
+
+// Hash generates a bcrypt hash for the password.
+func (b *Bcrypt) Hash(ctx context.Context, password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), b.cost)
+}
+
+// Compare verifies the password against the bcrypt hash.
+func (b *Bcrypt) Compare(ctx context.Context, hash []byte, password string) error {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrMismatch
+	}
+	return err
+}
+
+// Identify returns true if the hash was produced by bcrypt.
+func (b *Bcrypt) Identify(hash []byte) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if bytes.HasPrefix(hash, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NeedsRehash returns true if the cost recorded in the hash is not the
+// cost currently configured.
+func (b *Bcrypt) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	if err != nil {
+		return true
+	}
+	return cost != b.cost
+}
@@ -0,0 +1,87 @@
+// Package password provides support for hashing and verifying passwords.
+// Hashes are stored in a self describing format that records the algorithm
+// and parameters used, so hashes can be upgraded as users authenticate.
+package password
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMismatch is returned when a password does not match a hash.
+var ErrMismatch = errors.New("password does not match hash")
+
+// ErrUnknownHash is returned when no hasher recognizes the format of a hash.
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// Hasher declares a method set of behavior for hashing and verifying
+// passwords.
+type Hasher interface {
+	Hash(ctx context.Context, password string) ([]byte, error)
+	Compare(ctx context.Context, hash []byte, password string) error
+	Identify(hash []byte) bool
+	NeedsRehash(hash []byte) bool
+}
+
+// Default constructs the hasher used by the service. New hashes are produced
+// with argon2id using the specified parameters and existing bcrypt hashes are
+// still accepted until they are rehashed.
+func Default(params Params) Hasher {
+	return Migrating{
+		Primary: NewArgon2id(params),
+		Legacy:  []Hasher{NewBcrypt(BcryptDefaultCost)},
+	}
+}
+
+// =============================================================================
+
+// Migrating is a hasher that produces hashes with a primary hasher but can
+// verify hashes produced by a set of legacy hashers. Any hash not produced by
+// the primary hasher with its current parameters needs to be rehashed.
+type Migrating struct {
+	Primary Hasher
+	Legacy  []Hasher
+}
+
+// Hash generates a hash for the password using the primary hasher.
+func (m Migrating) Hash(ctx context.Context, password string) ([]byte, error) {
+	return m.Primary.Hash(ctx, password)
+}
+
+// Compare verifies the password against the hash with the hasher that
+// recognizes the format of the hash.
+func (m Migrating) Compare(ctx context.Context, hash []byte, password string) error {
+	h, err := m.hasher(hash)
+	if err != nil {
+		return err
+	}
+	return h.Compare(ctx, hash, password)
+}
+
+// Identify returns true if any of the hashers recognize the hash.
+func (m Migrating) Identify(hash []byte) bool {
+	_, err := m.hasher(hash)
+	return err == nil
+}
+
+// NeedsRehash returns true if the hash was not produced by the primary
+// hasher or its parameters are outdated.
+func (m Migrating) NeedsRehash(hash []byte) bool {
+	if !m.Primary.Identify(hash) {
+		return true
+	}
+	return m.Primary.NeedsRehash(hash)
+}
+
+// hasher locates the hasher that recognizes the format of the hash.
+func (m Migrating) hasher(hash []byte) (Hasher, error) {
+	if m.Primary.Identify(hash) {
+		return m.Primary, nil
+	}
+	for _, h := range m.Legacy {
+		if h.Identify(hash) {
+			return h, nil
+		}
+	}
+	return nil, ErrUnknownHash
+}
@@ -0,0 +1,155 @@
+package password_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/asishcse60/service/business/sys/password"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestPassword(t *testing.T) {
+	params := password.Params{
+		Memory:      1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	t.Log("Given the need to hash and verify passwords.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen using argon2id as the default hasher.", testID)
+		{
+			hasher := password.Default(params)
+
+			hash, err := hasher.Hash(context.Background(), "gophers")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hash a password: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to hash a password.", success, testID)
+
+			if err := hasher.Compare(context.Background(), hash, "gophers"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the password: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the password.", success, testID)
+
+			if err := hasher.Compare(context.Background(), hash, "goroutines"); !errors.Is(err, password.ErrMismatch) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to verify the wrong password: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to verify the wrong password.", success, testID)
+
+			if hasher.NeedsRehash(hash) {
+				t.Fatalf("\t%s\tTest %d:\tShould not need to rehash with the same parameters.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not need to rehash with the same parameters.", success, testID)
+
+			params.Iterations++
+			if !password.Default(params).NeedsRehash(hash) {
+				t.Fatalf("\t%s\tTest %d:\tShould need to rehash when the parameters change.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould need to rehash when the parameters change.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen verifying a legacy bcrypt hash.", testID)
+		{
+			hasher := password.Default(params)
+
+			// This is the hash for the admin user in the seed data.
+			hash := []byte("$2a$10$1ggfMVZV6Js0ybvJufLRUOWHS5f6KneuP0XwwHpJ8L8ipdry9f2/a")
+
+			if err := hasher.Compare(context.Background(), hash, "gophers"); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to verify the password: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to verify the password.", success, testID)
+
+			if !hasher.NeedsRehash(hash) {
+				t.Fatalf("\t%s\tTest %d:\tShould need to rehash a bcrypt hash.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould need to rehash a bcrypt hash.", success, testID)
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	t.Log("Given the need to bound the amount of concurrent hashing.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the queue of the pool is full.", testID)
+		{
+			hasher := blockingHasher{
+				started: make(chan struct{}),
+				release: make(chan struct{}),
+			}
+			pool := password.NewPool(hasher, 1, 1)
+
+			// Occupy the only worker.
+			done := make(chan error, 1)
+			go func() {
+				_, err := pool.Hash(context.Background(), "gophers")
+				done <- err
+			}()
+			<-hasher.started
+
+			// Occupy the only slot in the queue. The caller gives up right away
+			// but the job stays in the queue.
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if _, err := pool.Hash(ctx, "gophers"); !errors.Is(err, context.Canceled) {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to give up on queued work: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to give up on queued work.", success, testID)
+
+			if _, err := pool.Hash(context.Background(), "gophers"); !errors.Is(err, password.ErrSaturated) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject work when saturated: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject work when saturated.", success, testID)
+
+			close(hasher.release)
+			if err := <-done; err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould complete the running work: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould complete the running work.", success, testID)
+
+			pool.Shutdown()
+			if _, err := pool.Hash(context.Background(), "gophers"); !errors.Is(err, password.ErrClosed) {
+				t.Fatalf("\t%s\tTest %d:\tShould reject work once shut down: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject work once shut down.", success, testID)
+		}
+	}
+}
+
+// =============================================================================
+
+// blockingHasher signals when hashing starts and blocks until released.
+type blockingHasher struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h blockingHasher) Hash(ctx context.Context, password string) ([]byte, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return []byte(password), nil
+}
+
+func (h blockingHasher) Compare(ctx context.Context, hash []byte, password string) error {
+	return nil
+}
+
+func (h blockingHasher) Identify(hash []byte) bool {
+	return true
+}
+
+func (h blockingHasher) NeedsRehash(hash []byte) bool {
+	return false
+}
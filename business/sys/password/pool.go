@@ -0,0 +1,159 @@
+package password
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/asishcse60/service/business/sys/metrics"
+)
+
+// Set of error variables for the pool.
+var (
+	ErrSaturated = errors.New("password hashing is saturated, try again later")
+	ErrClosed    = errors.New("password hashing is shut down")
+)
+
+// job represents a unit of hashing work to be performed by a worker.
+type job struct {
+	ctx    context.Context
+	work   func() ([]byte, error)
+	result chan result
+}
+
+// result represents the outcome of a job.
+type result struct {
+	hash []byte
+	err  error
+}
+
+// Pool is a hasher that performs the expensive hashing work of another hasher
+// on a bounded set of worker goroutines. This keeps a burst of logins from
+// pinning every core and starving the rest of the service. Work is rejected
+// with ErrSaturated once the queue is full and with ErrClosed once the pool
+// is shut down.
+type Pool struct {
+	hasher Hasher
+	jobs   chan job
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewPool constructs a pool with the specified number of workers and a queue
+// that can hold the specified number of waiting jobs.
+func NewPool(hasher Hasher, workers int, queue int) *Pool {
+	p := Pool{
+		hasher: hasher,
+		jobs:   make(chan job, queue),
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				p.run(j)
+			}
+		}()
+	}
+
+	return &p
+}
+
+// Shutdown stops accepting work and waits for the workers to finish the
+// jobs that are already queued.
+func (p *Pool) Shutdown() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Hash generates a hash for the password on one of the workers.
+func (p *Pool) Hash(ctx context.Context, password string) ([]byte, error) {
+	return p.submit(ctx, func() ([]byte, error) {
+		return p.hasher.Hash(ctx, password)
+	})
+}
+
+// Compare verifies the password against the hash on one of the workers.
+func (p *Pool) Compare(ctx context.Context, hash []byte, password string) error {
+	_, err := p.submit(ctx, func() ([]byte, error) {
+		return nil, p.hasher.Compare(ctx, hash, password)
+	})
+	return err
+}
+
+// Identify returns true if the underlying hasher recognizes the hash.
+func (p *Pool) Identify(hash []byte) bool {
+	return p.hasher.Identify(hash)
+}
+
+// NeedsRehash returns true if the underlying hasher needs to rehash.
+func (p *Pool) NeedsRehash(hash []byte) bool {
+	return p.hasher.NeedsRehash(hash)
+}
+
+// submit queues the work and waits for it to complete or for the context
+// to be cancelled.
+func (p *Pool) submit(ctx context.Context, work func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+
+	j := job{
+		ctx:    ctx,
+		work:   work,
+		result: make(chan result, 1),
+	}
+
+	if err := p.queue(ctx, j); err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-j.result:
+		metrics.SetHashLatency(ctx, time.Since(start))
+		return res.hash, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// queue adds the job to the queue unless the queue is full or the pool is
+// shut down. The lock keeps Shutdown from closing the queue during the send.
+func (p *Pool) queue(ctx context.Context, j job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	select {
+	case p.jobs <- j:
+		metrics.SetHashQueue(ctx, len(p.jobs))
+		return nil
+	default:
+		metrics.AddHashSaturated(ctx)
+		return ErrSaturated
+	}
+}
+
+// run performs the work for a job unless the caller has already given up.
+func (p *Pool) run(j job) {
+	metrics.SetHashQueue(j.ctx, len(p.jobs))
+
+	if err := j.ctx.Err(); err != nil {
+		j.result <- result{err: err}
+		return
+	}
+
+	hash, err := j.work()
+	j.result <- result{hash: hash, err: err}
+}
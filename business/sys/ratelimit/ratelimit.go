@@ -0,0 +1,122 @@
+// Package ratelimit provides support for limiting how often a client can
+// call the api with token buckets.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrLimitExceeded is returned when a client has no tokens left in its bucket.
+var ErrLimitExceeded = errors.New("rate limit exceeded")
+
+// Limit describes a token bucket. The bucket holds up to Burst tokens and is
+// refilled with Rate tokens every Per.
+type Limit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// interval returns the time it takes to refill one token.
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Rate)
+}
+
+// Result describes the bucket of a client after taking a token.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the bucket is full again.
+	RetryAfter time.Duration // Until a token is available when not allowed.
+}
+
+// Store keeps the token buckets of the clients.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// Bucket is the state of a token bucket.
+type Bucket struct {
+	Tokens  float64
+	Updated time.Time
+}
+
+// Take refills the bucket for the time passed since it was last updated and
+// takes a token from it if there is one. A zero bucket is a full one.
+func Take(b Bucket, limit Limit, now time.Time) (Bucket, Result) {
+	tokens := float64(limit.Burst)
+	if !b.Updated.IsZero() {
+		elapsed := now.Sub(b.Updated)
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(float64(limit.Burst), b.Tokens+float64(elapsed)/float64(limit.interval()))
+	}
+
+	res := Result{
+		Limit: limit.Burst,
+	}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(limit.interval()))
+	}
+	res.Remaining = int(tokens)
+	res.Reset = time.Duration((float64(limit.Burst) - tokens) * float64(limit.interval()))
+
+	return Bucket{Tokens: tokens, Updated: now}, res
+}
+
+// =============================================================================
+
+// sweepInterval is how often buckets which are full again are dropped from
+// memory.
+const sweepInterval = time.Minute
+
+// Memory keeps the token buckets in memory. The limits only hold for a single
+// instance of the service.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]memoryBucket
+	swept   time.Time
+}
+
+// memoryBucket is a bucket with the time it will be full again.
+type memoryBucket struct {
+	Bucket
+	full time.Time
+}
+
+// NewMemory constructs a store keeping the token buckets in memory.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]memoryBucket),
+	}
+}
+
+// Take implements the Store interface.
+func (m *Memory) Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A bucket which is full again is the same as no bucket.
+	if now.Sub(m.swept) > sweepInterval {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.swept = now
+	}
+
+	b, res := Take(m.buckets[key].Bucket, limit, now)
+	m.buckets[key] = memoryBucket{Bucket: b, full: now.Add(res.Reset)}
+
+	return res, nil
+}
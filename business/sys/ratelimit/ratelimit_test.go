@@ -0,0 +1,68 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/asishcse60/service/business/sys/ratelimit"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestMemory(t *testing.T) {
+	store := ratelimit.NewMemory()
+	limit := ratelimit.Limit{Rate: 1, Per: time.Second, Burst: 3}
+	now := time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to limit how often a client can call the api.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client uses its burst.", testID)
+		{
+			for i := 0; i < limit.Burst; i++ {
+				res, err := store.Take(context.Background(), "client", limit, now)
+				if err != nil || !res.Allowed {
+					t.Fatalf("\t%s\tTest %d:\tShould be allowed call %d : %v", failed, testID, i, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould be allowed every call of the burst.", success, testID)
+
+			res, _ := store.Take(context.Background(), "client", limit, now)
+			if res.Allowed {
+				t.Fatalf("\t%s\tTest %d:\tShould not be allowed once the bucket is empty.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be allowed once the bucket is empty.", success, testID)
+
+			if res.RetryAfter != time.Second || res.Remaining != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould be told when to retry : %+v", failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be told when to retry.", success, testID)
+
+			if res, _ := store.Take(context.Background(), "other", limit, now); !res.Allowed {
+				t.Fatalf("\t%s\tTest %d:\tShould not limit other clients.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not limit other clients.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen time passes.", testID)
+		{
+			res, _ := store.Take(context.Background(), "client", limit, now.Add(time.Second))
+			if !res.Allowed {
+				t.Fatalf("\t%s\tTest %d:\tShould be allowed once a token was refilled : %+v", failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be allowed once a token was refilled.", success, testID)
+
+			res, _ = store.Take(context.Background(), "client", limit, now.Add(time.Hour))
+			if !res.Allowed || res.Remaining != limit.Burst-1 {
+				t.Fatalf("\t%s\tTest %d:\tShould not refill past the burst : %+v", failed, testID, res)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not refill past the burst.", success, testID)
+		}
+	}
+}
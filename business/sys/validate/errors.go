@@ -8,12 +8,6 @@ import (
 // ErrInvalidID occurs when an ID is not in a valid form.
 var ErrInvalidID = errors.New("ID is not in its proper form")
 
-// ErrorResponse is the form used for API responses from failures in the API.
-type ErrorResponse struct {
-	Error  string `json:"error"`
-	Fields string `json:"fields,omitempty"`
-}
-
 // RequestError is used to pass an error during the request through the
 // application with web specific context.
 type RequestError struct {
@@ -0,0 +1,87 @@
+package validate
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// PasswordPolicy defines the rules a password must follow to be accepted.
+// A zero value for a length disables that rule.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Breached  map[string]struct{}
+}
+
+// passwordPolicy holds the policy enforced by Password.
+var passwordPolicy struct {
+	mu     sync.RWMutex
+	policy PasswordPolicy
+}
+
+// SetPasswordPolicy replaces the policy enforced by Password.
+func SetPasswordPolicy(policy PasswordPolicy) {
+	passwordPolicy.mu.Lock()
+	defer passwordPolicy.mu.Unlock()
+
+	passwordPolicy.policy = policy
+}
+
+// ReadBreachedPasswords reads a list of known breached passwords, one per
+// line. Empty lines and lines starting with # are ignored.
+func ReadBreachedPasswords(r io.Reader) (map[string]struct{}, error) {
+	breached := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading breached passwords: %w", err)
+	}
+
+	return breached, nil
+}
+
+// Password validates the password against the configured password policy.
+func Password(password string) error {
+	passwordPolicy.mu.RLock()
+	policy := passwordPolicy.policy
+	passwordPolicy.mu.RUnlock()
+
+	var fields FieldErrors
+
+	length := utf8.RuneCountInString(password)
+	switch {
+	case policy.MinLength > 0 && length < policy.MinLength:
+		fields = append(fields, FieldError{
+			Field: "password",
+			Error: fmt.Sprintf("password must be at least %d characters in length", policy.MinLength),
+		})
+	case policy.MaxLength > 0 && length > policy.MaxLength:
+		fields = append(fields, FieldError{
+			Field: "password",
+			Error: fmt.Sprintf("password must be a maximum of %d characters in length", policy.MaxLength),
+		})
+	}
+
+	if _, exists := policy.Breached[password]; exists {
+		fields = append(fields, FieldError{
+			Field: "password",
+			Error: "password is known to have been exposed in a data breach",
+		})
+	}
+
+	if fields != nil {
+		return fields
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package validate
 
 import (
 	"errors"
+	"net/http"
 	"reflect"
 	"strings"
 
@@ -11,6 +12,8 @@ import (
 	"github.com/go-playground/validator/v10"
 	en_translations "github.com/go-playground/validator/v10/translations/en"
 	"github.com/google/uuid"
+
+	"github.com/asishcse60/service/foundation/web"
 )
 
 // validate holds the settings and caches for validating request struct values.
@@ -31,8 +34,14 @@ func init() {
 	// Register the english error messages for use.
 	en_translations.RegisterDefaultTranslations(validate, translator)
 
-	// Use JSON tag names for errors instead of Go struct names.
+	// Use JSON tag names for errors instead of Go struct names. Values bound
+	// from request parameters use the names of the parameters instead.
 	validate.RegisterTagNameFunc(func(fld reflect.StructField) string {
+		for _, tag := range []string{"param", "query"} {
+			if name := fld.Tag.Get(tag); name != "" {
+				return name
+			}
+		}
 		name := strings.SplitN(fld.Tag.Get("json"), ",", 2)[0]
 		if name == "-" {
 			return ""
@@ -66,6 +75,47 @@ func Check(val interface{}) error {
 	return nil
 }
 
+// Bind decodes the path and query parameters of the request into the
+// provided model and validates it against it's declared tags. Parameters
+// which can't be converted and values which fail validation are all
+// reported as FieldErrors.
+func Bind(r *http.Request, val interface{}) error {
+	var fields FieldErrors
+
+	failed := make(map[string]bool)
+	if err := web.Bind(r, val); err != nil {
+		var perrs web.ParamErrors
+		if !errors.As(err, &perrs) {
+			return err
+		}
+		for _, perr := range perrs {
+			fields = append(fields, FieldError{Field: perr.Param, Error: perr.Err.Error()})
+			failed[perr.Param] = true
+		}
+	}
+
+	if err := Check(val); err != nil {
+		var ferrs FieldErrors
+		if !errors.As(err, &ferrs) {
+			return err
+		}
+
+		// A parameter which couldn't be converted was left at its zero
+		// value, so checking it again would only repeat the failure.
+		for _, ferr := range ferrs {
+			if !failed[ferr.Field] {
+				fields = append(fields, ferr)
+			}
+		}
+	}
+
+	if len(fields) > 0 {
+		return fields
+	}
+
+	return nil
+}
+
 // GenerateID generate a unique id for entities.
 func GenerateID() string {
 	return uuid.NewString()
@@ -8,35 +8,90 @@ import (
 	"strings"
 
 	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/database"
 	"github.com/asishcse60/service/business/sys/validate"
 	"github.com/asishcse60/service/foundation/web"
 )
 
-// Authenticate validates a JWT from the `Authorization` header.
-func Authenticate(a *auth.Auth) web.Middleware {
+// Authenticate validates a JWT from the `Authorization` header. When a
+// checker is provided it is used to reject tokens that were revoked or that
+// belong to a suspended account. Tokens of a trusted source don't belong to
+// a local account so they are not checked.
+func Authenticate(a *auth.Auth, checker auth.ClaimsChecker) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
 
 		// Create the handler that will be attached in the middleware chain.
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			token, err := bearer(r)
+			if err != nil {
+				return validate.NewRequestError(err, http.StatusUnauthorized)
+			}
 
-			// Expecting: bearer <token>
-			authStr := r.Header.Get("authorization")
+			claims, err := authenticate(ctx, a, checker, token)
+			if err != nil {
+				return err
+			}
 
-			// Parse the authorization header.
-			parts := strings.Split(authStr, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				err := errors.New("expected authorization header format: bearer <token>")
+			// Add claims to the context, so they can be retrieved later.
+			ctx = auth.SetClaims(ctx, claims)
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// AuthenticateSession validates a JWT from the session cookie issued to
+// browser clients, falling back to the `Authorization` header when one is
+// provided. Requests using unsafe methods must echo the CSRF cookie in the
+// CSRF header, and the value must match the token bound to the session.
+func AuthenticateSession(a *auth.Auth, checker auth.ClaimsChecker) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// API clients can still use a bearer token on these routes.
+			if r.Header.Get("authorization") != "" {
+				return Authenticate(a, checker)(handler)(ctx, w, r)
+			}
+
+			session, err := r.Cookie(auth.SessionCookie)
+			if err != nil {
+				err := errors.New("expected authorization header or session cookie")
 				return validate.NewRequestError(err, http.StatusUnauthorized)
 			}
 
-			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
+			claims, err := authenticate(ctx, a, checker, session.Value)
 			if err != nil {
+				return err
+			}
+
+			// Only tokens issued for a session are bound to a CSRF token.
+			if claims.CSRF == "" {
+				err := errors.New("token was not issued for a session")
 				return validate.NewRequestError(err, http.StatusUnauthorized)
 			}
 
+			if !safeMethod(r.Method) {
+				var cookie string
+				if c, err := r.Cookie(auth.CSRFCookie); err == nil {
+					cookie = c.Value
+				}
+				if !auth.CheckCSRF(claims, r.Header.Get(auth.CSRFHeader), cookie) {
+					err := errors.New("missing or invalid csrf token")
+					return validate.NewRequestError(err, http.StatusForbidden)
+				}
+			}
+
 			// Add claims to the context, so they can be retrieved later.
 			ctx = auth.SetClaims(ctx, claims)
 
@@ -50,6 +105,63 @@ func Authenticate(a *auth.Auth) web.Middleware {
 	return m
 }
 
+// bearer returns the token from the `Authorization` header.
+func bearer(r *http.Request) (string, error) {
+
+	// Expecting: bearer <token>
+	authStr := r.Header.Get("authorization")
+
+	// Parse the authorization header.
+	parts := strings.Split(authStr, " ")
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return "", errors.New("expected authorization header format: bearer <token>")
+	}
+
+	return parts[1], nil
+}
+
+// authenticate validates the token and, when a checker is provided, that it
+// is still current for its subject. The caller is recorded in the request
+// values so it can be logged.
+func authenticate(ctx context.Context, a *auth.Auth, checker auth.ClaimsChecker, token string) (auth.Claims, error) {
+
+	// Validate the token is signed by us.
+	claims, err := a.ValidateToken(token)
+	if err != nil {
+		return auth.Claims{}, validate.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	// Validate the token is still current for the subject.
+	if checker != nil && !a.External(claims) {
+		if err := checker.CheckClaims(ctx, claims); err != nil {
+			switch {
+			case errors.Is(err, auth.ErrRevoked),
+				errors.Is(err, database.ErrAccountSuspended):
+				return auth.Claims{}, validate.NewRequestError(err, http.StatusUnauthorized)
+			default:
+				return auth.Claims{}, fmt.Errorf("checking claims: %w", err)
+			}
+		}
+	}
+
+	// Record who is making the request so it can be logged.
+	if err := web.SetIdentity(ctx, claims.Subject, claims.ActorSubject()); err != nil {
+		return auth.Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// safeMethod returns true for the methods that must not change state and so
+// don't need to be protected against cross site request forgery.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
 // Authorize validates that an authenticated user has at least one role from a
 // specified list. This method constructs the actual function that is used.
 func Authorize(roles ...string) web.Middleware {
@@ -84,3 +196,40 @@ func Authorize(roles ...string) web.Middleware {
 
 	return m
 }
+
+// RequirePermission validates that an authenticated user is granted at least
+// one permission from a specified list by the policy. Since the policy also
+// honors the scope claim, this is how a route declares the scopes a token
+// must carry when it is restricted.
+func RequirePermission(policy *auth.Policy, perms ...string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// If the context is missing this value return failure.
+			claims, err := auth.GetClaims(ctx)
+			if err != nil {
+				return validate.NewRequestError(
+					fmt.Errorf("you are not authorized for that action, no claims"),
+					http.StatusForbidden,
+				)
+			}
+
+			if !policy.Permitted(claims, perms...) {
+				return validate.NewRequestError(
+					fmt.Errorf("you are not authorized for that action, claims[%v] permissions[%v]", claims.Roles, perms),
+					http.StatusForbidden,
+				)
+			}
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
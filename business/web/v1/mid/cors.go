@@ -0,0 +1,143 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// CORSConfig describes the cross origin requests browsers are allowed to
+// make. An origin can be listed exactly, as "*" to allow any origin or with
+// a wildcard in place of its subdomains like "https://*.example.com".
+//
+// Any origin can't be allowed together with credentials, it would let every
+// site call the api as the user of the browser.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// Validate checks the configuration is safe to use.
+func (cfg CORSConfig) Validate() error {
+	if !cfg.AllowCredentials {
+		return nil
+	}
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" {
+			return errors.New("any origin can't be allowed with credentials")
+		}
+	}
+	return nil
+}
+
+// allowOrigin returns the value of the Access-Control-Allow-Origin header
+// for the origin, false if requests from it aren't allowed. Any origin is
+// allowed with a literal "*" so browsers never send credentials with it.
+func (cfg CORSConfig) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range cfg.AllowedOrigins {
+		if allowed == "*" && !cfg.AllowCredentials {
+			return "*", true
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin, true
+		}
+
+		scheme, host, ok := splitOrigin(allowed)
+		if !ok || !strings.HasPrefix(host, "*.") {
+			continue
+		}
+		oScheme, oHost, ok := splitOrigin(origin)
+		if ok && strings.EqualFold(scheme, oScheme) && strings.HasSuffix(strings.ToLower(oHost), strings.ToLower(host[1:])) {
+			return origin, true
+		}
+	}
+
+	return "", false
+}
+
+// CORS lets browsers call the api from the allowed origins. The headers
+// granting access are added to every response for an allowed origin,
+// including error responses, and preflight requests are answered without
+// calling the rest of the chain. Requests from other origins are handled as
+// usual, without the headers the browser won't share the response. Without
+// allowed origins the middleware does nothing.
+//
+// Preflight requests only reach the middleware when the app answers OPTIONS
+// requests, see web.App.Options.
+func CORS(cfg CORSConfig) web.Middleware {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+		if len(cfg.AllowedOrigins) == 0 {
+			return handler
+		}
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// The response depends on the origin even when it isn't allowed
+			// so caches must not share it between origins.
+			w.Header().Add("Vary", "Origin")
+
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return handler(ctx, w, r)
+			}
+			allowed, ok := cfg.allowOrigin(origin)
+			if !ok {
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+
+			return web.Respond(ctx, w, nil, http.StatusNoContent)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// splitOrigin splits an origin into its scheme and host.
+func splitOrigin(origin string) (scheme string, host string, ok bool) {
+	i := strings.Index(origin, "://")
+	if i < 0 {
+		return "", "", false
+	}
+	return origin[:i], origin[i+3:], true
+}
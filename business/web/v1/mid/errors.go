@@ -2,17 +2,55 @@ package mid
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"go.uber.org/zap"
 
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/password"
+	"github.com/asishcse60/service/business/sys/ratelimit"
 	"github.com/asishcse60/service/business/sys/validate"
+	v1Web "github.com/asishcse60/service/business/web/v1"
 	"github.com/asishcse60/service/foundation/web"
 )
 
+// retryAfter is the number of seconds a client is asked to wait before trying
+// again when the service is temporarily unavailable.
+const retryAfter = "1"
+
+// problems maps the errors of the business and web layers to the status and
+// code of the problem sent to the client. The detail is the message of the
+// listed error unless one is set, the error returned by the handler wraps
+// internals like ids and queries so its full message is only logged.
+// Handlers only have to return a request error for failures which aren't
+// listed here or which need another status.
+var problems = []struct {
+	err    error
+	status int
+	code   string
+	detail string
+}{
+	{database.ErrInvalidID, http.StatusBadRequest, v1Web.CodeInvalidID, ""},
+	{database.ErrNotFound, http.StatusNotFound, v1Web.CodeNotFound, ""},
+	{database.ErrAuthenticationFailure, http.StatusUnauthorized, v1Web.CodeUnauthenticated, ""},
+	{database.ErrAccountSuspended, http.StatusForbidden, v1Web.CodeAccountSuspended, ""},
+	{database.ErrForbidden, http.StatusForbidden, v1Web.CodeForbidden, ""},
+	{auth.ErrInvalidScope, http.StatusBadRequest, v1Web.CodeInvalidScope, ""},
+	{ratelimit.ErrLimitExceeded, http.StatusTooManyRequests, v1Web.CodeRateLimited, ""},
+	{password.ErrSaturated, http.StatusServiceUnavailable, v1Web.CodeUnavailable, ""},
+	{password.ErrClosed, http.StatusServiceUnavailable, v1Web.CodeUnavailable, ""},
+	{web.ErrNotAcceptable, http.StatusNotAcceptable, v1Web.CodeNotAcceptable, ""},
+	{web.ErrUnsupportedMediaType, http.StatusUnsupportedMediaType, v1Web.CodeUnsupportedMediaType, ""},
+	{web.ErrBodyTooLarge, http.StatusRequestEntityTooLarge, v1Web.CodeBodyTooLarge, ""},
+	{ErrTimeout, http.StatusGatewayTimeout, v1Web.CodeTimeout, ""},
+}
+
 // Errors handles errors coming out of the call chain. It detects normal
-// application errors which are used to respond to the client in a uniform way.
-// Unexpected errors (status >= 500) are logged.
+// application errors which are used to respond to the client in a uniform way
+// with an application/problem+json document. Unexpected errors (status >= 500)
+// are logged.
 func Errors(log *zap.SugaredLogger) web.Middleware {
 
 	// This is the actual middleware function to be executed.
@@ -34,30 +72,23 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 				// Log the error.
 				log.Errorw("ERROR", "traceid", v.TraceID, "ERROR", err)
 
-				// Build out the error response.
-				var er validate.ErrorResponse
-				var status int
-				switch act := validate.Cause(err).(type) {
-				case validate.FieldErrors:
-					er = validate.ErrorResponse{
-						Error:  "data validation error",
-						Fields: act.Error(),
-					}
-					status = http.StatusBadRequest
-				case *validate.RequestError:
-					er = validate.ErrorResponse{
-						Error: act.Error(),
-					}
-					status = act.Status
-				default:
-					er = validate.ErrorResponse{
-						Error: http.StatusText(http.StatusInternalServerError),
-					}
-					status = http.StatusInternalServerError
+				// A streamed response already sent its status code so there
+				// is nothing left to tell the client.
+				if web.IsStreamAborted(err) {
+					return nil
+				}
+
+				// Build out the problem.
+				prb := problem(err)
+				prb.Instance = r.URL.Path
+				prb.TraceID = v.TraceID
+
+				if prb.Status == http.StatusServiceUnavailable {
+					w.Header().Set("Retry-After", retryAfter)
 				}
 
 				// Respond with the error back to the client.
-				if err := web.Respond(ctx, w, er, status); err != nil {
+				if err := web.Respond(ctx, w, prb, prb.Status); err != nil {
 					return err
 				}
 
@@ -77,3 +108,41 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 
 	return m
 }
+
+// problem converts the error into the problem sent to the client. Request
+// errors raised by handlers take precedence over the errors they wrap.
+func problem(err error) v1Web.Problem {
+	var re *validate.RequestError
+	if errors.As(err, &re) {
+		return v1Web.NewProblem(re.Status, re.Error())
+	}
+
+	var fields validate.FieldErrors
+	if errors.As(err, &fields) {
+		prb := v1Web.NewProblem(http.StatusBadRequest, "data validation error")
+		prb.Code = v1Web.CodeValidationFailed
+		prb.Errors = fields
+		return prb
+	}
+
+	var de *web.DecodeError
+	if errors.As(err, &de) {
+		prb := v1Web.NewProblem(http.StatusBadRequest, de.Error())
+		prb.Code = v1Web.CodeInvalidBody
+		return prb
+	}
+
+	for _, p := range problems {
+		if errors.Is(err, p.err) {
+			detail := p.detail
+			if detail == "" {
+				detail = p.err.Error()
+			}
+			prb := v1Web.NewProblem(p.status, detail)
+			prb.Code = p.code
+			return prb
+		}
+	}
+
+	return v1Web.NewProblem(http.StatusInternalServerError, "")
+}
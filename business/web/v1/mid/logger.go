@@ -31,8 +31,15 @@ func Logger(log *zap.SugaredLogger) web.Middleware {
 			// Call the next handler.
 			err = handler(ctx, w, r)
 
-			log.Infow("request completed", "traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
-				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now))
+			kv := []interface{}{"traceid", v.TraceID, "method", r.Method, "path", r.URL.Path,
+				"remoteaddr", r.RemoteAddr, "statuscode", v.StatusCode, "since", time.Since(v.Now)}
+			if v.Subject != "" {
+				kv = append(kv, "subject", v.Subject)
+			}
+			if v.Actor != "" {
+				kv = append(kv, "actor", v.Actor)
+			}
+			log.Infow("request completed", kv...)
 
 			// Return the error so it can be handled further up the chain.
 			return err
@@ -0,0 +1,431 @@
+package mid_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/sys/database"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+	v1Web "github.com/asishcse60/service/business/web/v1"
+	"github.com/asishcse60/service/business/web/v1/mid"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestErrors(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	app := web.NewApp(make(chan os.Signal, 1), mid.Errors(log))
+
+	app.Handle(http.MethodGet, "", "/products/:id", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("querying product[%s] with query[SELECT * FROM products]: %w", web.Param(r, "id"), database.ErrNotFound)
+	})
+
+	t.Log("Given the need to respond to errors with a problem document.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a handler returns a wrapped business error.", testID)
+		{
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products/42", nil))
+
+			if w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 404 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 404.", success, testID)
+
+			var prb v1Web.Problem
+			if err := json.NewDecoder(w.Body).Decode(&prb); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the problem : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decode the problem.", success, testID)
+
+			if prb.Detail != database.ErrNotFound.Error() || strings.Contains(prb.Detail, "SELECT") {
+				t.Fatalf("\t%s\tTest %d:\tShould only describe the business error : %q", failed, testID, prb.Detail)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only describe the business error.", success, testID)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	app := web.NewApp(make(chan os.Signal, 1), mid.Errors(log), mid.Timeout(50*time.Millisecond))
+
+	// wait blocks until the context is done or the duration passed. It
+	// returns the error of the context.
+	wait := func(d time.Duration) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("querying: %w", ctx.Err())
+			case <-time.After(d):
+				return web.Respond(ctx, w, nil, http.StatusNoContent)
+			}
+		}
+	}
+
+	app.Handle(http.MethodGet, "", "/app", wait(time.Second))
+	app.Handle(http.MethodGet, "", "/longer", wait(150*time.Millisecond), mid.Timeout(time.Second))
+	app.Handle(http.MethodGet, "", "/shorter", wait(time.Second), mid.Timeout(10*time.Millisecond))
+	app.Handle(http.MethodGet, "", "/upstream", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return fmt.Errorf("calling provider: %w", context.DeadlineExceeded)
+	})
+
+	serve := func(r *http.Request) (*httptest.ResponseRecorder, time.Duration) {
+		start := time.Now()
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w, time.Since(start)
+	}
+
+	t.Log("Given the need to bound the time requests can run.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a request runs past the timeout of the app.", testID)
+		{
+			w, _ := serve(httptest.NewRequest(http.MethodGet, "/app", nil))
+			if w.Code != http.StatusGatewayTimeout {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 504 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 504.", success, testID)
+
+			var prb v1Web.Problem
+			if err := json.NewDecoder(w.Body).Decode(&prb); err != nil || prb.Code != v1Web.CodeTimeout {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the timeout code : %q %v", failed, testID, prb.Code, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive the timeout code.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a route has a longer timeout.", testID)
+		{
+			if w, _ := serve(httptest.NewRequest(http.MethodGet, "/longer", nil)); w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould run past the timeout of the app : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould run past the timeout of the app.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a route has a shorter timeout.", testID)
+		{
+			w, took := serve(httptest.NewRequest(http.MethodGet, "/shorter", nil))
+			if w.Code != http.StatusGatewayTimeout {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 504 : %v", failed, testID, w.Code)
+			}
+			if took >= 50*time.Millisecond {
+				t.Fatalf("\t%s\tTest %d:\tShould stop before the timeout of the app : %v", failed, testID, took)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop before the timeout of the app.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the client goes away.", testID)
+		{
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			w, took := serve(httptest.NewRequest(http.MethodGet, "/longer", nil).WithContext(ctx))
+			if took >= 50*time.Millisecond {
+				t.Fatalf("\t%s\tTest %d:\tShould stop with the request : %v", failed, testID, took)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop with the request.", success, testID)
+
+			if w.Code == http.StatusGatewayTimeout {
+				t.Fatalf("\t%s\tTest %d:\tShould not report a timeout.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not report a timeout.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen a call made by the handler times out.", testID)
+		{
+			w, _ := serve(httptest.NewRequest(http.MethodGet, "/upstream", nil))
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("\t%s\tTest %d:\tShould not be answered as a timeout of the request : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be answered as a timeout of the request.", success, testID)
+		}
+	}
+}
+
+// failingStore is a rate limit store which is down.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit, now time.Time) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	log := zap.NewNop().Sugar()
+	limit := ratelimit.Limit{Rate: 1, Per: time.Minute, Burst: 2}
+
+	ok := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	cfg := mid.RateLimitConfig{
+		Store:        ratelimit.NewMemory(),
+		ProxyHeader:  "X-Forwarded-For",
+		APIKeyHeader: "X-API-Key",
+	}
+
+	app := web.NewApp(make(chan os.Signal, 1), mid.Errors(log))
+	app.Handle(http.MethodGet, "", "/client", ok, mid.RateLimit(log, cfg, "client", limit))
+	app.Handle(http.MethodGet, "", "/email", ok, mid.RateLimitEmail(log, cfg, "email", limit))
+	app.Handle(http.MethodGet, "", "/down", ok, mid.RateLimit(log, mid.RateLimitConfig{Store: failingStore{}}, "down", limit))
+
+	// serve sends a request from the given address through the proxy.
+	serve := func(target string, addr string, setup func(r *http.Request)) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.Header.Set("X-Forwarded-For", "203.0.113.9, "+addr)
+		if setup != nil {
+			setup(r)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to limit how often clients call the api.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client has requests left.", testID)
+		{
+			w := serve("/client", "192.0.2.1", nil)
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204.", success, testID)
+
+			if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "1" || w.Header().Get("RateLimit-Reset") != "60" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the state of the limit : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive the state of the limit.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a client is out of requests.", testID)
+		{
+			serve("/client", "192.0.2.1", nil)
+			w := serve("/client", "192.0.2.1", nil)
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 429 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 429.", success, testID)
+
+			if w.Header().Get("Retry-After") != "60" || w.Header().Get("RateLimit-Remaining") != "0" {
+				t.Fatalf("\t%s\tTest %d:\tShould be told when to retry : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould be told when to retry.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen other clients call the api.", testID)
+		{
+			if w := serve("/client", "192.0.2.2", nil); w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould tell clients apart by the address added by the proxy : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell clients apart by the address added by the proxy.", success, testID)
+
+			key := func(k string) func(r *http.Request) {
+				return func(r *http.Request) { r.Header.Set("X-API-Key", k) }
+			}
+			if w := serve("/client", "192.0.2.1", key("key-1")); w.Code != http.StatusTooManyRequests {
+				t.Fatalf("\t%s\tTest %d:\tShould not get more requests with an api key : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not get more requests with an api key.", success, testID)
+
+			serve("/client", "192.0.2.3", key("key-2"))
+			serve("/client", "192.0.2.4", key("key-2"))
+			if w := serve("/client", "192.0.2.5", key("key-2")); w.Code != http.StatusTooManyRequests {
+				t.Fatalf("\t%s\tTest %d:\tShould limit an api key used from many addresses : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould limit an api key used from many addresses.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen signing in as the same user from many addresses.", testID)
+		{
+			basic := func(r *http.Request) { r.SetBasicAuth("User@example.com", "gophers") }
+			serve("/email", "192.0.2.1", basic)
+			serve("/email", "192.0.2.2", basic)
+
+			w := serve("/email", "192.0.2.3", func(r *http.Request) { r.SetBasicAuth("user@example.com", "gophers") })
+			if w.Code != http.StatusTooManyRequests {
+				t.Fatalf("\t%s\tTest %d:\tShould limit the requests for the email : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould limit the requests for the email.", success, testID)
+
+			if w := serve("/email", "192.0.2.3", nil); w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould let requests without an email through : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould let requests without an email through.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen the store is down.", testID)
+		{
+			w := serve("/down", "192.0.2.1", nil)
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould let the request through : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould let the request through.", success, testID)
+
+			if w.Header().Get("RateLimit-Limit") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not send the state of the limit : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not send the state of the limit.", success, testID)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	log := zap.NewNop().Sugar()
+
+	ok := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.Respond(ctx, w, nil, http.StatusNoContent)
+	}
+
+	// newApp constructs an app answering preflight requests for the origins.
+	newApp := func(cfg mid.CORSConfig) *web.App {
+		app := web.NewApp(make(chan os.Signal, 1), mid.CORS(cfg), mid.Errors(log))
+		app.Options(ok)
+		app.Handle(http.MethodGet, "", "/products", ok)
+		return app
+	}
+
+	cfg := mid.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+	app := newApp(cfg)
+
+	// serve sends a request from the origin.
+	serve := func(app *web.App, method string, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/products", nil)
+		r.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to let browsers call the api from other origins.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a request comes from a listed origin.", testID)
+		{
+			w := serve(app, http.MethodGet, "https://app.example.com")
+			if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+				t.Fatalf("\t%s\tTest %d:\tShould allow the origin with credentials : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow the origin with credentials.", success, testID)
+
+			if w.Header().Get("Access-Control-Expose-Headers") != "Retry-After" {
+				t.Fatalf("\t%s\tTest %d:\tShould expose the headers : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould expose the headers.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a request comes from a subdomain of a wildcard origin.", testID)
+		{
+			if w := serve(app, http.MethodGet, "https://shop.example.org"); w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.org" {
+				t.Fatalf("\t%s\tTest %d:\tShould allow the subdomain : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow the subdomain.", success, testID)
+
+			for _, origin := range []string{"http://shop.example.org", "https://example.org", "https://shopexample.org"} {
+				if w := serve(app, http.MethodGet, origin); w.Header().Get("Access-Control-Allow-Origin") != "" {
+					t.Fatalf("\t%s\tTest %d:\tShould not allow %s : %v", failed, testID, origin, w.Header())
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow other schemes and domains.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a request comes from an origin which isn't listed.", testID)
+		{
+			w := serve(app, http.MethodGet, "https://evil.example.net")
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould handle the request as usual : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould handle the request as usual.", success, testID)
+
+			if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not allow the origin : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not allow the origin.", success, testID)
+
+			if w.Header().Get("Vary") != "Origin" {
+				t.Fatalf("\t%s\tTest %d:\tShould vary on the origin : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould vary on the origin.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen a browser sends a preflight request.", testID)
+		{
+			w := serve(app, http.MethodOptions, "https://app.example.com")
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 204 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 204.", success, testID)
+
+			if w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+				w.Header().Get("Access-Control-Allow-Headers") != "Authorization, Content-Type" ||
+				w.Header().Get("Access-Control-Max-Age") != "3600" {
+				t.Fatalf("\t%s\tTest %d:\tShould describe the allowed requests : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould describe the allowed requests.", success, testID)
+
+			if w := serve(app, http.MethodOptions, "https://evil.example.net"); w.Header().Get("Access-Control-Allow-Methods") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not describe them to other origins : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not describe them to other origins.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen any origin is allowed.", testID)
+		{
+			anyOrigin := mid.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+			if err := anyOrigin.Validate(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to allow credentials.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to allow credentials.", success, testID)
+
+			anyOrigin.AllowCredentials = false
+			if err := anyOrigin.Validate(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the config without credentials : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the config without credentials.", success, testID)
+
+			w := serve(newApp(anyOrigin), http.MethodGet, "https://evil.example.net")
+			if w.Header().Get("Access-Control-Allow-Origin") != "*" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not echo the origin : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not echo the origin.", success, testID)
+		}
+	}
+}
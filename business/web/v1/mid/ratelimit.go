@@ -0,0 +1,180 @@
+package mid
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/asishcse60/service/business/sys/auth"
+	"github.com/asishcse60/service/business/sys/ratelimit"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// RateLimitConfig describes where the buckets of the clients are kept and
+// how clients are told apart.
+type RateLimitConfig struct {
+
+	// Store keeps the buckets of the clients. Nil disables rate limiting.
+	Store ratelimit.Store
+
+	// ProxyHeader names the header the proxy in front of the api puts the
+	// address of the client in, like X-Forwarded-For. The last address in
+	// the header is used since that's the one added by the proxy. Empty uses
+	// the address of the connection, which must be done when clients reach
+	// the api directly or they could pick their own address.
+	ProxyHeader string
+
+	// APIKeyHeader names the header carrying the api key of the client. The
+	// key isn't verified by the api so the address of the client is limited
+	// as well, a client can't get more requests by changing its key. Empty
+	// ignores api keys.
+	APIKeyHeader string
+}
+
+// RateLimit limits how often a client can call the routes sharing the policy
+// with the given name. Authenticated clients are identified by the subject of
+// their claims, other clients by their address and by their api key when
+// they send one, so the middleware must run after authentication to tell
+// users apart. The state of the limit is sent back in the RateLimit headers.
+//
+// The request is let through when the store fails, an outage of the store
+// shouldn't take the api down with it. A nil store disables the limit.
+func RateLimit(log *zap.SugaredLogger, cfg RateLimitConfig, name string, limit ratelimit.Limit) web.Middleware {
+	return rateLimit(log, cfg.Store, name, limit, cfg.clients)
+}
+
+// RateLimitEmail limits how often the routes sharing the policy with the
+// given name can be called for the email provided in Basic auth, no matter
+// which client does it. Along with RateLimit it slows down guessing the
+// password of one user from many addresses. Requests without Basic auth
+// aren't limited by it.
+func RateLimitEmail(log *zap.SugaredLogger, cfg RateLimitConfig, name string, limit ratelimit.Limit) web.Middleware {
+	return rateLimit(log, cfg.Store, name, limit, func(ctx context.Context, r *http.Request) []string {
+		email, _, ok := r.BasicAuth()
+		if !ok || email == "" {
+			return nil
+		}
+		return []string{"email:" + digest(strings.ToLower(email))}
+	})
+}
+
+// rateLimit limits the requests by the keys returned for them, a request is
+// only let through when every bucket has a token. Requests without keys
+// aren't limited.
+func rateLimit(log *zap.SugaredLogger, store ratelimit.Store, name string, limit ratelimit.Limit, keys func(ctx context.Context, r *http.Request) []string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+		if store == nil {
+			return handler
+		}
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// If the context is missing this value, request the service
+			// to be shutdown gracefully.
+			v, err := web.GetValues(ctx)
+			if err != nil {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			// The headers describe the bucket with the fewest tokens left.
+			var res ratelimit.Result
+			var taken bool
+			for _, id := range keys(ctx, r) {
+				bucket := name + ":" + id
+				br, err := store.Take(ctx, bucket, limit, v.Now)
+				if err != nil {
+					log.Errorw("ratelimit", "traceid", v.TraceID, "key", bucket, "ERROR", err)
+					continue
+				}
+				if !taken || !br.Allowed || br.Remaining < res.Remaining {
+					res = br
+				}
+				taken = true
+				if !br.Allowed {
+					break
+				}
+			}
+			if !taken {
+				return handler(ctx, w, r)
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", seconds(res.Reset))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", seconds(res.RetryAfter))
+				return fmt.Errorf("policy %s: %w", name, ratelimit.ErrLimitExceeded)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// clients identifies the client of the request, by the subject of its
+// claims when it is authenticated. Otherwise it's identified by its address
+// and by its api key when it sent one.
+func (cfg RateLimitConfig) clients(ctx context.Context, r *http.Request) []string {
+	if claims, err := auth.GetClaims(ctx); err == nil {
+		return []string{"sub:" + claims.Subject}
+	}
+
+	ids := []string{"ip:" + cfg.address(r)}
+	if cfg.APIKeyHeader != "" {
+		if key := r.Header.Get(cfg.APIKeyHeader); key != "" {
+			ids = append(ids, "key:"+digest(key))
+		}
+	}
+
+	return ids
+}
+
+// address returns the address of the client, as reported by the proxy when
+// one is configured.
+func (cfg RateLimitConfig) address(r *http.Request) string {
+	if cfg.ProxyHeader != "" {
+		values := r.Header.Values(cfg.ProxyHeader)
+		if len(values) > 0 {
+			addrs := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return ip
+}
+
+// digest hashes a secret or personal value so it isn't kept in the store.
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// seconds formats a duration as a number of whole seconds, rounded up so
+// clients don't come back too early.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
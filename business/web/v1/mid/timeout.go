@@ -0,0 +1,110 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asishcse60/service/business/sys/metrics"
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// ErrTimeout is returned when a request didn't complete before the deadline
+// set by Timeout.
+var ErrTimeout = errors.New("request did not complete before its deadline")
+
+// Timeout bounds how long the rest of the call chain can run by setting a
+// deadline on the request context, which is honored by the database calls
+// made with it. A Timeout on a route replaces the timeout set for the app,
+// so a route can be given more time as well as less, and a timeout of zero
+// or less removes the deadline.
+//
+// Errors returned once the deadline passed are reported as ErrTimeout so
+// they are answered with a 504. Deadlines set by anything else, like the
+// client of another service, are left alone.
+func Timeout(timeout time.Duration) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// A timeout set further up the chain is replaced by deriving the
+			// deadline from the context the request started with.
+			if dl, ok := ctx.Value(deadlineKey).(*deadline); ok {
+				ctx, cancel := dl.derive(ctx, timeout)
+				defer cancel()
+
+				return handler(ctx, w, r.WithContext(ctx))
+			}
+
+			dl := deadline{parent: ctx}
+			ctx = context.WithValue(ctx, deadlineKey, &dl)
+
+			ctx, cancel := dl.derive(ctx, timeout)
+			defer cancel()
+
+			err := handler(ctx, w, r.WithContext(ctx))
+
+			if err != nil && dl.exceeded() {
+				metrics.AddTimeouts(ctx)
+				err = fmt.Errorf("%w: %v", ErrTimeout, err)
+			}
+
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// deadlineKey is how the deadline of a request is stored/retrieved.
+const deadlineKey ctxKey = 1
+
+// deadline keeps the context the request started with so the timeout of a
+// route doesn't depend on the timeout of the app, and the context carrying
+// the deadline in effect.
+type deadline struct {
+	parent  context.Context
+	current context.Context
+}
+
+// derive returns a context with the values of ctx which is done when the
+// parent is or once the timeout passed. It becomes the deadline in effect.
+func (dl *deadline) derive(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	var current context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		current, cancel = context.WithTimeout(dl.parent, timeout)
+	} else {
+		current, cancel = context.WithCancel(dl.parent)
+	}
+	dl.current = current
+
+	return valuesFrom{Context: current, values: ctx}, cancel
+}
+
+// exceeded returns true if the deadline in effect has passed.
+func (dl *deadline) exceeded() bool {
+	return errors.Is(dl.current.Err(), context.DeadlineExceeded)
+}
+
+// valuesFrom is a context taking its deadline and cancellation from the
+// embedded context and its values from another.
+type valuesFrom struct {
+	context.Context
+	values context.Context
+}
+
+// Value implements the context.Context interface.
+func (vf valuesFrom) Value(key interface{}) interface{} {
+	return vf.values.Value(key)
+}
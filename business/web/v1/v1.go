@@ -1,44 +1,105 @@
 // Package v1 represents types used by the web application for v1.
 package v1
 
-import "errors"
+import (
+	"encoding/xml"
+	"net/http"
 
-// ErrorResponse is the form used for API responses from failures in the API.
-type ErrorResponse struct {
-	Error  string            `json:"error"`
-	Fields map[string]string `json:"fields,omitempty"`
-}
+	"github.com/asishcse60/service/business/sys/validate"
+)
 
-// RequestError is used to pass an error during the request through the
-// application with web specific context.
-type RequestError struct {
-	Err    error
-	Status int
-}
+// ProblemType is the type of every problem. There is no document published
+// per type of problem, the code is what tells the failures apart.
+const ProblemType = "about:blank"
+
+// Set of codes reported with problems. Clients can rely on these so they must
+// not be changed once published.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeInvalidBody          = "invalid_body"
+	CodeInvalidID            = "invalid_id"
+	CodeInvalidScope         = "invalid_scope"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnauthenticated      = "unauthenticated"
+	CodeForbidden            = "forbidden"
+	CodeAccountSuspended     = "account_suspended"
+	CodeNotFound             = "not_found"
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeRateLimited          = "rate_limited"
+	CodeUnavailable          = "unavailable"
+	CodeTimeout              = "timeout"
+	CodeInternal             = "internal_error"
+)
 
-// NewRequestError wraps a provided error with an HTTP status code. This
-// function should be used when handlers encounter expected errors.
-func NewRequestError(err error, status int) error {
-	return &RequestError{err, status}
+// Problem is the application/problem+json document defined by RFC 7807 used
+// for API responses from failures in the API.
+type Problem struct {
+	XMLName  xml.Name              `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+	Type     string                `json:"type"`
+	Title    string                `json:"title"`
+	Status   int                   `json:"status"`
+	Detail   string                `json:"detail,omitempty"`
+	Instance string                `json:"instance,omitempty"`
+	Code     string                `json:"code"`
+	TraceID  string                `json:"trace_id,omitempty"`
+	Errors   []validate.FieldError `json:"errors,omitempty"`
 }
 
-// Error implements the error interface. It uses the default message of the
-// wrapped error. This is what will be shown in the services' logs.
-func (re *RequestError) Error() string {
-	return re.Err.Error()
+// NewProblem constructs a problem for the status, using the code a client
+// would expect for it.
+func NewProblem(status int, detail string) Problem {
+	return Problem{
+		Type:   ProblemType,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   StatusCode(status),
+	}
 }
 
-// IsRequestError checks if an error of type RequestError exists.
-func IsRequestError(err error) bool {
-	var re *RequestError
-	return errors.As(err, &re)
+// ContentType implements the web.ContentTyper interface so a problem is
+// sent as application/problem+json or application/problem+xml.
+func (p Problem) ContentType(mediaType string) string {
+	switch mediaType {
+	case "application/json":
+		return "application/problem+json"
+	case "application/xml":
+		return "application/problem+xml"
+	}
+	return mediaType
 }
 
-// GetRequestError returns a copy of the RequestError pointer.
-func GetRequestError(err error) *RequestError {
-	var re *RequestError
-	if !errors.As(err, &re) {
-		return nil
+// StatusCode returns the code of a problem which only has a status.
+func StatusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return CodeNotAcceptable
+	case http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status < http.StatusInternalServerError {
+		return CodeInvalidRequest
 	}
-	return re
+	return CodeInternal
 }
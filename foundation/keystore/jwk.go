@@ -0,0 +1,193 @@
+package keystore
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+)
+
+// JWK represents the public part of a key as defined by RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS represents a JSON Web Key Set as defined by RFC 7517.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys held by the store as a key set. Retired keys
+// are included until their grace period has passed. The keys are sorted by
+// kid so the document is stable between calls.
+func (ks *KeyStore) JWKS() JWKS {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	now := time.Now()
+
+	jwks := JWKS{
+		Keys: make([]JWK, 0, len(ks.store)),
+	}
+	for kid, privateKey := range ks.store {
+		if ks.expired(kid, now) {
+			continue
+		}
+		jwk, err := NewJWK(kid, privateKey.Public())
+		if err != nil {
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
+
+// NewJWK constructs the JWK for the specified public key. The algorithm is
+// derived from the type of the key.
+func NewJWK(kid string, publicKey crypto.PublicKey) (JWK, error) {
+	switch pk := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     kid,
+			N:         encode(pk.N.Bytes()),
+			E:         encode(big.NewInt(int64(pk.E)).Bytes()),
+		}, nil
+
+	case *ecdsa.PublicKey:
+		crv, alg, err := curve(pk.Curve)
+		if err != nil {
+			return JWK{}, err
+		}
+
+		// The coordinates must be padded to the size of the curve.
+		size := (pk.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			KeyType:   "EC",
+			Use:       "sig",
+			Algorithm: alg,
+			KeyID:     kid,
+			Curve:     crv,
+			X:         encode(pk.X.FillBytes(make([]byte, size))),
+			Y:         encode(pk.Y.FillBytes(make([]byte, size))),
+		}, nil
+
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			Use:       "sig",
+			Algorithm: "EdDSA",
+			KeyID:     kid,
+			Curve:     "Ed25519",
+			X:         encode(pk),
+		}, nil
+	}
+
+	return JWK{}, errors.New("unsupported key type")
+}
+
+// PublicKey returns the public key described by the JWK.
+func (jwk JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, errors.New("invalid modulus")
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+
+	case "EC":
+		var c elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			c = elliptic.P256()
+		case "P-384":
+			c = elliptic.P384()
+		case "P-521":
+			c = elliptic.P521()
+		default:
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, errors.New("invalid x coordinate")
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, errors.New("invalid y coordinate")
+		}
+		pk := ecdsa.PublicKey{
+			Curve: c,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !c.IsOnCurve(pk.X, pk.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &pk, nil
+
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err := decode(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, errors.New("unsupported key type")
+}
+
+// curve returns the JWK curve name and signing algorithm for the curve.
+func curve(c elliptic.Curve) (string, string, error) {
+	switch c.Params().BitSize {
+	case 256:
+		return "P-256", "ES256", nil
+	case 384:
+		return "P-384", "ES384", nil
+	case 521:
+		return "P-521", "ES512", nil
+	}
+
+	return "", "", errors.New("unsupported curve")
+}
+
+// encode returns the unpadded base64url encoding of the bytes.
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode returns the bytes of an unpadded base64url encoded string.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
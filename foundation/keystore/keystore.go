@@ -3,45 +3,135 @@
 package keystore
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"github.com/golang-jwt/jwt/v4"
 	"io"
 	"io/fs"
+	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/youmark/pkcs8"
 )
 
+// Key describes a key held by the store.
+type Key struct {
+	KID       string    `json:"kid"`
+	Retired   bool      `json:"retired"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
 // KeyStore represents an in memory store implementation of the
-// KeyLookup interface for use with the auth package.
+// KeyLookup interface for use with the auth package. Keys that are retired
+// can no longer be used to sign, but continue to validate tokens until the
+// grace period has passed. The active key, the one signing new tokens,
+// can't be retired until another key is made active.
 type KeyStore struct {
-	mu    sync.RWMutex
-	store map[string]*rsa.PrivateKey
+	mu      sync.RWMutex
+	store   map[string]crypto.Signer
+	retired map[string]time.Time
+	active  string
+	files   map[string][sha256.Size]byte
+	fsys    fs.FS
+	grace   time.Duration
+
+	passphrase []byte
 }
 
-// New constructs an empty KeyStore ready for use.
-func New() *KeyStore {
-	return &KeyStore{
-		store: make(map[string]*rsa.PrivateKey),
+// Option represents a function that can configure a KeyStore.
+type Option func(ks *KeyStore)
+
+// WithGrace sets the amount of time a retired key continues to validate
+// tokens. It should be longer than the lifetime of the tokens being issued.
+func WithGrace(grace time.Duration) Option {
+	return func(ks *KeyStore) {
+		ks.grace = grace
+	}
+}
+
+// WithPassphrase sets the passphrase used to decrypt the key files that are
+// stored as encrypted PKCS#8.
+func WithPassphrase(passphrase []byte) Option {
+	return func(ks *KeyStore) {
+		ks.passphrase = passphrase
 	}
 }
+
+// New constructs an empty KeyStore ready for use.
+func New(opts ...Option) *KeyStore {
+	return NewMap(make(map[string]crypto.Signer), opts...)
+}
+
 // NewMap constructs a KeyStore with an initial set of keys.
-func NewMap(store map[string]*rsa.PrivateKey) *KeyStore {
-	return &KeyStore{
-		store: store,
+func NewMap(store map[string]crypto.Signer, opts ...Option) *KeyStore {
+	ks := KeyStore{
+		store:   store,
+		retired: make(map[string]time.Time),
+		files:   make(map[string][sha256.Size]byte),
+	}
+
+	for _, opt := range opts {
+		opt(&ks)
 	}
+
+	return &ks
 }
+
 // NewFS constructs a KeyStore based on a set of PEM files rooted inside
 // of a directory. The name of each PEM file will be used as the key id.
 // Example: keystore.NewFS(os.DirFS("/zarf/keys/"))
 // Example: /zarf/keys/54bb2165-71e1-41a6-af3e-7da4a0e1e2c1.pem
-func NewFS(fsys fs.FS) (*KeyStore, error) {
-	ks := KeyStore{
-		store: make(map[string]*rsa.PrivateKey),
+func NewFS(fsys fs.FS, opts ...Option) (*KeyStore, error) {
+	ks := NewMap(make(map[string]crypto.Signer), opts...)
+	ks.fsys = fsys
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Reload reads the directory the store was constructed with again. Keys
+// found for the first time are added and keys whose file was removed are
+// retired. Keys that were retired are never brought back. A kid identifies
+// a key for its whole life so a key file that changed fails the reload
+// instead of replacing the key, a new key needs a new kid. Removing the file
+// of the active key fails the reload and leaves the store as it was.
+func (ks *KeyStore) Reload() error {
+	if ks.fsys == nil {
+		return errors.New("keystore is not backed by a directory")
 	}
 
+	ks.mu.RLock()
+	known := make(map[string]struct{}, len(ks.store)+len(ks.retired))
+	for kid := range ks.store {
+		known[kid] = struct{}{}
+	}
+	for kid := range ks.retired {
+		known[kid] = struct{}{}
+	}
+	sums := make(map[string][sha256.Size]byte, len(ks.files))
+	for kid, sum := range ks.files {
+		sums[kid] = sum
+	}
+	ks.mu.RUnlock()
+
+	found := make(map[string][sha256.Size]byte)
+	keys := make(map[string]crypto.Signer)
+
 	fn := func(fileName string, dirEntry fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("walkdir failure: %w", err)
@@ -55,7 +145,9 @@ func NewFS(fsys fs.FS) (*KeyStore, error) {
 			return nil
 		}
 
-		file, err := fsys.Open(fileName)
+		kid := strings.TrimSuffix(dirEntry.Name(), ".pem")
+
+		file, err := ks.fsys.Open(fileName)
 		if err != nil {
 			return fmt.Errorf("opening key file: %w", err)
 		}
@@ -69,27 +161,88 @@ func NewFS(fsys fs.FS) (*KeyStore, error) {
 			return fmt.Errorf("reading auth private key: %w", err)
 		}
 
-		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		sum := sha256.Sum256(privatePEM)
+		found[kid] = sum
+		if prev, exists := sums[kid]; exists && prev != sum {
+			return fmt.Errorf("key file %s changed, a new key needs a new kid", fileName)
+		}
+		if _, exists := known[kid]; exists {
+			return nil
+		}
+
+		privateKey, err := ParsePrivateKey(privatePEM, ks.passphrase)
 		if err != nil {
-			return fmt.Errorf("parsing auth private key: %w", err)
+			return fmt.Errorf("parsing auth private key %s: %w", fileName, err)
 		}
 
-		ks.store[strings.TrimSuffix(dirEntry.Name(), ".pem")] = privateKey
+		keys[kid] = privateKey
 		return nil
 	}
 
-	if err := fs.WalkDir(fsys, ".", fn); err != nil {
-		return nil, fmt.Errorf("walking directory: %w", err)
+	if err := fs.WalkDir(ks.fsys, ".", fn); err != nil {
+		return fmt.Errorf("walking directory: %w", err)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, exists := ks.files[ks.active]; exists {
+		if _, exists := found[ks.active]; !exists {
+			return fmt.Errorf("key file of the active key %s was removed", ks.active)
+		}
+	}
+
+	for kid, privateKey := range keys {
+		if _, retired := ks.retired[kid]; retired {
+			continue
+		}
+		ks.store[kid] = privateKey
+	}
+
+	now := time.Now()
+	for kid := range ks.files {
+		if _, exists := found[kid]; !exists {
+			ks.retire(kid, now)
+		}
 	}
+	ks.files = found
 
-	return &ks, nil
+	ks.prune(now)
+
+	return nil
+}
+
+// Poll reloads the directory the store was constructed with on the specified
+// interval until the context is cancelled. Errors are reported to the
+// provided function and do not stop the polling. An interval of zero or less
+// disables polling.
+func (ks *KeyStore) Poll(ctx context.Context, interval time.Duration, errFn func(error)) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ks.Reload(); err != nil {
+				errFn(err)
+			}
+		}
+	}
 }
+
 // Add adds a private key and combination kid to the store.
-func (ks *KeyStore) Add(privateKey *rsa.PrivateKey, kid string) {
+func (ks *KeyStore) Add(privateKey crypto.Signer, kid string) {
 	ks.mu.Lock()
 	defer ks.mu.Unlock()
 
 	ks.store[kid] = privateKey
+	delete(ks.retired, kid)
 }
 
 // Remove removes a private key and combination kid to the store.
@@ -98,11 +251,70 @@ func (ks *KeyStore) Remove(kid string) {
 	defer ks.mu.Unlock()
 
 	delete(ks.store, kid)
+	delete(ks.retired, kid)
+}
+
+// SetActive records the key used to sign new tokens so it can't be retired.
+func (ks *KeyStore) SetActive(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, found := ks.store[kid]; !found {
+		return errors.New("kid lookup failed")
+	}
+	if _, retired := ks.retired[kid]; retired {
+		return errors.New("kid is retired")
+	}
+
+	ks.active = kid
+	return nil
+}
+
+// Retire stops the key from being used to sign new tokens. The key continues
+// to validate tokens until the grace period has passed.
+func (ks *KeyStore) Retire(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if _, found := ks.store[kid]; !found {
+		return errors.New("kid lookup failed")
+	}
+	if kid == ks.active {
+		return errors.New("the active key can't be retired")
+	}
+
+	ks.retire(kid, time.Now())
+	return nil
+}
+
+// Keys returns the information about the keys held by the store sorted by
+// kid.
+func (ks *KeyStore) Keys() []Key {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.prune(time.Now())
+
+	keys := make([]Key, 0, len(ks.store))
+	for kid := range ks.store {
+		key := Key{KID: kid}
+		if retiredAt, retired := ks.retired[kid]; retired {
+			key.Retired = true
+			key.ExpiresAt = retiredAt.Add(ks.grace)
+		}
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].KID < keys[j].KID
+	})
+
+	return keys
 }
 
 // PrivateKey searches the key store for a given kid and returns
 // the private key.
-func (ks *KeyStore) PrivateKey(kid string) (*rsa.PrivateKey, error) {
+func (ks *KeyStore) PrivateKey(kid string) (crypto.Signer, error) {
 	ks.mu.RLock()
 	defer ks.mu.RUnlock()
 
@@ -110,18 +322,145 @@ func (ks *KeyStore) PrivateKey(kid string) (*rsa.PrivateKey, error) {
 	if !found {
 		return nil, errors.New("kid lookup failed")
 	}
+	if _, retired := ks.retired[kid]; retired {
+		return nil, errors.New("kid is retired")
+	}
 	return privateKey, nil
 }
 
 // PublicKey searches the key store for a given kid and returns
 // the public key.
-func (ks *KeyStore) PublicKey(kid string) (*rsa.PublicKey, error) {
+func (ks *KeyStore) PublicKey(kid string) (crypto.PublicKey, error) {
 	ks.mu.RLock()
 	defer ks.mu.RUnlock()
 
 	privateKey, found := ks.store[kid]
-	if !found {
+	if !found || ks.expired(kid, time.Now()) {
 		return nil, errors.New("kid lookup failed")
 	}
-	return &privateKey.PublicKey, nil
+	return privateKey.Public(), nil
+}
+
+// retire marks the key as retired at the specified time unless it already
+// was.
+func (ks *KeyStore) retire(kid string, now time.Time) {
+	if _, retired := ks.retired[kid]; !retired {
+		ks.retired[kid] = now
+	}
+}
+
+// expired returns true if the key was retired and the grace period has
+// passed.
+func (ks *KeyStore) expired(kid string, now time.Time) bool {
+	retiredAt, retired := ks.retired[kid]
+	return retired && !now.Before(retiredAt.Add(ks.grace))
+}
+
+// prune removes the keys that have expired. The retirement is remembered so
+// a reload does not bring the key back.
+func (ks *KeyStore) prune(now time.Time) {
+	for kid := range ks.store {
+		if ks.expired(kid, now) {
+			delete(ks.store, kid)
+		}
+	}
+}
+
+// ReadPassphrase returns the passphrase used to encrypt key files. It is
+// either provided directly or read from a secrets file, in which case the
+// trailing newline is removed.
+func ReadPassphrase(passphrase string, fileName string) ([]byte, error) {
+	if fileName == "" {
+		if passphrase == "" {
+			return nil, errors.New("passphrase or passphrase file is required")
+		}
+		return []byte(passphrase), nil
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase file: %w", err)
+	}
+
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, errors.New("passphrase file is empty")
+	}
+	return data, nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA, ECDSA or Ed25519 private key. The
+// key can be stored in PKCS#1, SEC 1 or PKCS#8 form. Keys stored as encrypted
+// PKCS#8 are decrypted with the passphrase.
+func ParsePrivateKey(privatePEM []byte, passphrase []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil {
+		return nil, errors.New("key must be PEM encoded")
+	}
+
+	switch block.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		if len(passphrase) == 0 {
+			return nil, errors.New("key is encrypted and no passphrase is configured")
+		}
+		key, _, err := pkcs8.ParsePrivateKey(block.Bytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting key: %w", err)
+		}
+		return signer(key)
+
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return signer(key)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+}
+
+// MarshalEncryptedPrivateKey encodes the private key as encrypted PKCS#8 in
+// a PEM block. The key is encrypted using AES-256-CBC with a key derived
+// from the passphrase using PBKDF2.
+func MarshalEncryptedPrivateKey(privateKey crypto.Signer, passphrase []byte) (*pem.Block, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase is required")
+	}
+
+	opts := pkcs8.Opts{
+		Cipher: pkcs8.AES256CBC,
+		KDFOpts: pkcs8.PBKDF2Opts{
+			SaltSize:       16,
+			IterationCount: 600000,
+			HMACHash:       crypto.SHA256,
+		},
+	}
+	der, err := pkcs8.MarshalPrivateKey(privateKey, passphrase, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting key: %w", err)
+	}
+
+	block := pem.Block{
+		Type:  "ENCRYPTED PRIVATE KEY",
+		Bytes: der,
+	}
+	return &block, nil
+}
+
+// signer returns the private key parsed from PKCS#8 as a crypto.Signer.
+func signer(key interface{}) (crypto.Signer, error) {
+	switch pk := key.(type) {
+	case *rsa.PrivateKey:
+		return pk, nil
+	case *ecdsa.PrivateKey:
+		return pk, nil
+	case ed25519.PrivateKey:
+		return pk, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", key)
 }
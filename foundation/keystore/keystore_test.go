@@ -0,0 +1,449 @@
+package keystore_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/asishcse60/service/foundation/keystore"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestJWKS(t *testing.T) {
+	t.Log("Given the need to publish the public keys of the store.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a store with a single key.", testID)
+		{
+			const keyID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+			privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create a private key.", success, testID)
+
+			ks := keystore.NewMap(map[string]crypto.Signer{keyID: privateKey})
+
+			jwks := ks.JWKS()
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != keyID {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the key in the key set: %+v", failed, testID, jwks)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the key in the key set.", success, testID)
+
+			if jwks.Keys[0].Algorithm != "RS256" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the RS256 algorithm: %s", failed, testID, jwks.Keys[0].Algorithm)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the RS256 algorithm.", success, testID)
+
+			publicKey, err := jwks.Keys[0].PublicKey()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the public key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decode the public key.", success, testID)
+
+			if !privateKey.PublicKey.Equal(publicKey) {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same public key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same public key.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen handling ECDSA and Ed25519 keys stored as PKCS#8.", testID)
+		{
+			ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an ECDSA key: %v", failed, testID, err)
+			}
+			_, ed, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create an Ed25519 key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create the keys.", success, testID)
+
+			fsys := fstest.MapFS{
+				"ec.pem": &fstest.MapFile{Data: pkcs8PEM(t, testID, ec)},
+				"ed.pem": &fstest.MapFile{Data: pkcs8PEM(t, testID, ed)},
+			}
+			ks, err := keystore.NewFS(fsys)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct the store.", success, testID)
+
+			want := map[string]crypto.PublicKey{"ec": ec.Public(), "ed": ed.Public()}
+			algs := map[string]string{"ec": "ES256", "ed": "EdDSA"}
+			for _, jwk := range ks.JWKS().Keys {
+				if jwk.Algorithm != algs[jwk.KeyID] {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the %s algorithm for %s: %s", failed, testID, algs[jwk.KeyID], jwk.KeyID, jwk.Algorithm)
+				}
+				publicKey, err := jwk.PublicKey()
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to decode the public key %s: %v", failed, testID, jwk.KeyID, err)
+				}
+				if !publicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(want[jwk.KeyID]) {
+					t.Fatalf("\t%s\tTest %d:\tShould get back the same public key for %s.", failed, testID, jwk.KeyID)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same public keys and algorithms.", success, testID)
+		}
+	}
+}
+
+func TestRotation(t *testing.T) {
+	t.Log("Given the need to rotate the keys of a store backed by a directory.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen adding and removing key files.", testID)
+		{
+			const oldKID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+			const newKID = "4754d86b-7a6d-4df5-9c65-224741361492"
+
+			fsys := fstest.MapFS{
+				oldKID + ".pem": &fstest.MapFile{Data: genPEM(t, testID)},
+			}
+
+			ks, err := keystore.NewFS(fsys, keystore.WithGrace(time.Hour))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct the store.", success, testID)
+
+			delete(fsys, oldKID+".pem")
+			fsys[newKID+".pem"] = &fstest.MapFile{Data: genPEM(t, testID)}
+
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the store: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reload the store.", success, testID)
+
+			if _, err := ks.PrivateKey(newKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to sign with the new key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to sign with the new key.", success, testID)
+
+			if _, err := ks.PrivateKey(oldKID); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to sign with the retired key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to sign with the retired key.", success, testID)
+
+			if _, err := ks.PublicKey(oldKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate with the retired key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to validate with the retired key.", success, testID)
+
+			if jwks := ks.JWKS(); len(jwks.Keys) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould publish both keys during the grace period: %d", failed, testID, len(jwks.Keys))
+			}
+			t.Logf("\t%s\tTest %d:\tShould publish both keys during the grace period.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the grace period of a retired key has passed.", testID)
+		{
+			const kid = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+
+			fsys := fstest.MapFS{
+				kid + ".pem": &fstest.MapFile{Data: genPEM(t, testID)},
+			}
+
+			ks, err := keystore.NewFS(fsys)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct the store.", success, testID)
+
+			if err := ks.Retire(kid); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retire the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retire the key.", success, testID)
+
+			if _, err := ks.PublicKey(kid); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to validate with the expired key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to validate with the expired key.", success, testID)
+
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the store: %v", failed, testID, err)
+			}
+			if _, err := ks.PublicKey(kid); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not bring back the expired key on reload.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not bring back the expired key on reload.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen the file of the active key is removed.", testID)
+		{
+			const oldKID = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+			const newKID = "4754d86b-7a6d-4df5-9c65-224741361492"
+
+			oldPEM := genPEM(t, testID)
+			fsys := fstest.MapFS{
+				oldKID + ".pem": &fstest.MapFile{Data: oldPEM},
+			}
+
+			ks, err := keystore.NewFS(fsys, keystore.WithGrace(time.Hour))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+			if err := ks.SetActive(oldKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to activate the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to activate the key.", success, testID)
+
+			if err := ks.Retire(oldKID); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to retire the active key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to retire the active key.", success, testID)
+
+			delete(fsys, oldKID+".pem")
+			fsys[newKID+".pem"] = &fstest.MapFile{Data: genPEM(t, testID)}
+
+			if err := ks.Reload(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould fail the reload while the key is active.", failed, testID)
+			}
+			if _, err := ks.PrivateKey(oldKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep signing with the active key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail the reload while the key is active.", success, testID)
+
+			fsys[oldKID+".pem"] = &fstest.MapFile{Data: oldPEM}
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reload the store: %v", failed, testID, err)
+			}
+			if err := ks.SetActive(newKID); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to activate the new key: %v", failed, testID, err)
+			}
+			delete(fsys, oldKID+".pem")
+			if err := ks.Reload(); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould retire the key once another is active: %v", failed, testID, err)
+			}
+			if _, err := ks.PrivateKey(oldKID); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould retire the key once another is active.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retire the key once another is active.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the file of a known key is replaced.", testID)
+		{
+			const kid = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+
+			fsys := fstest.MapFS{
+				kid + ".pem": &fstest.MapFile{Data: genPEM(t, testID)},
+			}
+
+			ks, err := keystore.NewFS(fsys)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct the store.", success, testID)
+
+			before, err := ks.PublicKey(kid)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the key: %v", failed, testID, err)
+			}
+
+			fsys[kid+".pem"] = &fstest.MapFile{Data: genPEM(t, testID)}
+
+			if err := ks.Reload(); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reject the changed key file.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject the changed key file.", success, testID)
+
+			after, err := ks.PublicKey(kid)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the key: %v", failed, testID, err)
+			}
+			if !before.(*rsa.PublicKey).Equal(after) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the key loaded first.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the key loaded first.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen polling is disabled.", testID)
+		{
+			ks, err := keystore.NewFS(fstest.MapFS{})
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the store: %v", failed, testID, err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				ks.Poll(context.Background(), 0, func(error) {})
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould return right away.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return right away.", success, testID)
+		}
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	t.Log("Given the need to store private keys encrypted with a passphrase.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling an encrypted key file.", testID)
+		{
+			const kid = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+			passphrase := []byte("gophers")
+
+			privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+			}
+
+			block, err := keystore.MarshalEncryptedPrivateKey(privateKey, passphrase)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encrypt the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to encrypt the key.", success, testID)
+
+			fsys := fstest.MapFS{
+				kid + ".pem": &fstest.MapFile{Data: pem.EncodeToMemory(block)},
+			}
+
+			if _, err := keystore.NewFS(fsys); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not load the key without a passphrase.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not load the key without a passphrase.", success, testID)
+
+			if _, err := keystore.NewFS(fsys, keystore.WithPassphrase([]byte("rustaceans"))); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not load the key with the wrong passphrase.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not load the key with the wrong passphrase.", success, testID)
+
+			ks, err := keystore.NewFS(fsys, keystore.WithPassphrase(passphrase))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould load the key with the passphrase: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould load the key with the passphrase.", success, testID)
+
+			signer, err := ks.PrivateKey(kid)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve the key: %v", failed, testID, err)
+			}
+			if !privateKey.Equal(signer) {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the same key.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the same key.", success, testID)
+		}
+	}
+}
+
+func TestRemote(t *testing.T) {
+	const kid = "54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Should be able to create a private key: %v", err)
+	}
+	jwks := keystore.NewMap(map[string]crypto.Signer{kid: privateKey}).JWKS()
+
+	var block, entered chan struct{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if block != nil {
+			entered <- struct{}{}
+			<-block
+		}
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	defer srv.Close()
+
+	t.Log("Given the need to look up the keys of a remote key set.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the key set is fetched again while a key is cached.", testID)
+		{
+			r := keystore.NewRemote(srv.URL, keystore.WithTTL(0), keystore.WithMinRefresh(0))
+
+			if _, err := r.PublicKey(kid); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch the key: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch the key.", success, testID)
+
+			block = make(chan struct{})
+			entered = make(chan struct{})
+
+			fetched := make(chan error)
+			go func() {
+				_, err := r.PublicKey(kid)
+				fetched <- err
+			}()
+			<-entered
+
+			cached := make(chan error)
+			go func() {
+				_, err := r.PublicKey(kid)
+				cached <- err
+			}()
+
+			select {
+			case err := <-cached:
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould get the cached key during the fetch: %v", failed, testID, err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould get the cached key without waiting for the fetch.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the cached key without waiting for the fetch.", success, testID)
+
+			close(block)
+			if err := <-fetched; err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch the key again: %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to fetch the key again.", success, testID)
+		}
+	}
+}
+
+// pkcs8PEM encodes the private key as a PKCS#8 PEM block.
+func pkcs8PEM(t *testing.T, testID int, privateKey crypto.Signer) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to marshal the private key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: der,
+	}
+	return pem.EncodeToMemory(&block)
+}
+
+// genPEM generates a private key encoded as a PEM block.
+func genPEM(t *testing.T, testID int) []byte {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("\t%s\tTest %d:\tShould be able to create a private key: %v", failed, testID, err)
+	}
+
+	block := pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	}
+	return pem.EncodeToMemory(&block)
+}
@@ -0,0 +1,211 @@
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Remote represents a key lookup backed by a JWKS document published by
+// another service. It can only be used to validate tokens. The document is
+// cached and fetched again once the TTL has passed or when a token refers
+// to a kid that is unknown. Failed fetches are retried with an exponential
+// backoff so an unavailable provider isn't hammered. A single fetch runs at
+// a time and lookups don't wait for it when the key is cached.
+type Remote struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	maxBackoff time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	nextFetch time.Time
+	backoff   time.Duration
+	fetching  chan struct{}
+}
+
+// RemoteOption represents a function that can configure a Remote.
+type RemoteOption func(r *Remote)
+
+// WithHTTPClient sets the client used to fetch the JWKS document.
+func WithHTTPClient(client *http.Client) RemoteOption {
+	return func(r *Remote) {
+		r.client = client
+	}
+}
+
+// WithTTL sets how long a fetched JWKS document is used before it is
+// fetched again.
+func WithTTL(ttl time.Duration) RemoteOption {
+	return func(r *Remote) {
+		r.ttl = ttl
+	}
+}
+
+// WithMinRefresh sets the minimum time between two fetches, which bounds
+// how often an unknown kid can cause the document to be fetched.
+func WithMinRefresh(minRefresh time.Duration) RemoteOption {
+	return func(r *Remote) {
+		r.minRefresh = minRefresh
+	}
+}
+
+// WithMaxBackoff sets the maximum time to wait before retrying a failed
+// fetch.
+func WithMaxBackoff(maxBackoff time.Duration) RemoteOption {
+	return func(r *Remote) {
+		r.maxBackoff = maxBackoff
+	}
+}
+
+// NewRemote constructs a Remote for the JWKS document at the specified url.
+// Nothing is fetched until the first key is looked up.
+func NewRemote(url string, opts ...RemoteOption) *Remote {
+	r := Remote{
+		url:        url,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		ttl:        time.Hour,
+		minRefresh: 10 * time.Second,
+		maxBackoff: 5 * time.Minute,
+		keys:       make(map[string]crypto.PublicKey),
+	}
+
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	return &r
+}
+
+// PrivateKey implements the auth.KeyLookup interface. A remote key set never
+// holds private keys so this always fails.
+func (r *Remote) PrivateKey(kid string) (crypto.Signer, error) {
+	return nil, errors.New("remote keystore can't sign tokens")
+}
+
+// PublicKey searches the remote key set for a given kid and returns the
+// public key. The document is fetched again when it is stale or the kid is
+// unknown. If the fetch fails the cached key is used when there is one.
+func (r *Remote) PublicKey(kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+
+	now := time.Now()
+
+	publicKey, found := r.keys[kid]
+	stale := now.Sub(r.fetchedAt) >= r.ttl
+
+	if (!stale && found) || now.Before(r.nextFetch) {
+		r.mu.Unlock()
+		if !found {
+			return nil, errors.New("kid lookup failed")
+		}
+		return publicKey, nil
+	}
+
+	// Another lookup is already fetching the document. Use the cached key
+	// when there is one, otherwise wait for the fetch and look again.
+	if fetching := r.fetching; fetching != nil {
+		r.mu.Unlock()
+		if found {
+			return publicKey, nil
+		}
+		<-fetching
+		return r.PublicKey(kid)
+	}
+
+	fetching := make(chan struct{})
+	r.fetching = fetching
+	r.mu.Unlock()
+
+	keys, err := r.fetch()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.update(keys, err, time.Now())
+	r.fetching = nil
+	close(fetching)
+
+	publicKey, found = r.keys[kid]
+	if !found {
+		if err != nil {
+			return nil, fmt.Errorf("kid lookup failed: %w", err)
+		}
+		return nil, errors.New("kid lookup failed")
+	}
+	return publicKey, nil
+}
+
+// update records the result of a fetch, replacing the cached keys when it
+// succeeded and backing off when it failed. It must be called with the lock
+// held.
+func (r *Remote) update(keys map[string]crypto.PublicKey, err error, now time.Time) {
+	if err != nil {
+		if r.backoff == 0 {
+			r.backoff = r.minRefresh
+		} else {
+			r.backoff *= 2
+		}
+		if r.backoff > r.maxBackoff {
+			r.backoff = r.maxBackoff
+		}
+		r.nextFetch = now.Add(r.backoff)
+		return
+	}
+
+	r.keys = keys
+	r.fetchedAt = now
+	r.nextFetch = now.Add(r.minRefresh)
+	r.backoff = 0
+}
+
+// fetch retrieves and decodes the JWKS document.
+func (r *Remote) fetch() (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	// limit the document to 1 megabyte which is plenty for any key set.
+	var jwks JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1024*1024)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = publicKey
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,200 @@
+package web
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamError describes a path or query parameter which couldn't be
+// converted to the type of its field.
+type ParamError struct {
+	Param string
+	Err   error
+}
+
+// ParamErrors represents every parameter which couldn't be bound.
+type ParamErrors []ParamError
+
+// Error implements the error interface.
+func (pe ParamErrors) Error() string {
+	msgs := make([]string, len(pe))
+	for i, p := range pe {
+		msgs[i] = fmt.Sprintf("%s: %s", p.Param, p.Err)
+	}
+	return "binding parameters: " + strings.Join(msgs, ", ")
+}
+
+// errUnsupportedType is returned for a field whose type can't be bound. It
+// is a mistake in the struct rather than in the request so it isn't reported
+// as a ParamError.
+var errUnsupportedType = errors.New("unsupported type")
+
+// textUnmarshaler is used to bind types like time.Time and uuid.UUID which
+// know how to parse themselves.
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Bind decodes the path and query parameters of a request into the struct
+// the value points to. A field is bound to a path parameter with the param
+// tag and to a query parameter with the query tag, and the default tag is
+// used when the parameter is missing or empty.
+//
+//	type query struct {
+//	    Page  int       `param:"page"`
+//	    Rows  int       `query:"rows" default:"20"`
+//	    Since time.Time `query:"since"`
+//	    Tags  []string  `query:"tag"`
+//	}
+//
+// Strings, bools, ints, uints, floats, durations and types implementing
+// encoding.TextUnmarshaler are supported, and slices of them are bound to
+// repeated query parameters. Every parameter which can't be converted is
+// reported with ParamErrors, a field of any other type fails the binding
+// with a plain error.
+func Bind(r *http.Request, val interface{}) error {
+	rv := reflect.ValueOf(val)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("must provide a pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	query := r.URL.Query()
+
+	var errs ParamErrors
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		var name string
+		var values []string
+		switch {
+		case field.Tag.Get("param") != "":
+			name = field.Tag.Get("param")
+			if v := Param(r, name); v != "" {
+				values = []string{v}
+			}
+		case field.Tag.Get("query") != "":
+			name = field.Tag.Get("query")
+			for _, v := range query[name] {
+				if v != "" {
+					values = append(values, v)
+				}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			def, exists := field.Tag.Lookup("default")
+			if !exists {
+				continue
+			}
+			values = []string{def}
+		}
+
+		if err := bindField(rv.Field(i), values); err != nil {
+			if errors.Is(err, errUnsupportedType) {
+				return fmt.Errorf("binding field %s: %w", field.Name, err)
+			}
+			errs = append(errs, ParamError{Param: name, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// bindField sets the field from the values of its parameter.
+func bindField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshaler) && !reflect.PtrTo(field.Type()).Implements(textUnmarshaler) {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := bindValue(slice.Index(i), v); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+
+	if len(values) > 1 {
+		return errors.New("must only be provided once")
+	}
+
+	return bindValue(field, values[0])
+}
+
+// bindValue converts the value of a parameter to the type of the field.
+func bindValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := bindValue(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if tu, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := tu.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid value %q", value)
+		}
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%q is not a duration", value)
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a positive integer", value)
+		}
+		field.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(f)
+
+	default:
+		return fmt.Errorf("%w %s", errUnsupportedType, field.Type())
+	}
+
+	return nil
+}
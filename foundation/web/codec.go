@@ -0,0 +1,277 @@
+package web
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ErrUnsupported is returned by a codec that can't represent a value.
+var ErrUnsupported = errors.New("value is not supported by the codec")
+
+// Codec declares the behavior required to encode responses and decode
+// requests for a media type. A codec returns ErrUnsupported for the values
+// it can't represent so another acceptable codec can be tried.
+type Codec interface {
+	MediaType() string
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+var codecs = struct {
+	mu   sync.RWMutex
+	list []Codec
+}{
+	list: []Codec{JSON{}, XML{}, MessagePack{}, CSV{}},
+}
+
+// RegisterCodec adds a codec for its media type, replacing the codec that
+// was registered for it. The JSON codec is the default and is used when
+// the client doesn't state a preference.
+func RegisterCodec(c Codec) {
+	codecs.mu.Lock()
+	defer codecs.mu.Unlock()
+
+	for i, ec := range codecs.list {
+		if ec.MediaType() == c.MediaType() {
+			codecs.list[i] = c
+			return
+		}
+	}
+	codecs.list = append(codecs.list, c)
+}
+
+// registered returns the codecs in the order they were registered.
+func registered() []Codec {
+	codecs.mu.RLock()
+	defer codecs.mu.RUnlock()
+
+	list := make([]Codec, len(codecs.list))
+	copy(list, codecs.list)
+	return list
+}
+
+// =============================================================================
+
+// JSON encodes and decodes JSON documents. Unknown fields are rejected
+// when decoding.
+type JSON struct{}
+
+// MediaType implements the Codec interface.
+func (JSON) MediaType() string {
+	return "application/json"
+}
+
+// Encode implements the Codec interface.
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Decode implements the Codec interface.
+func (JSON) Decode(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// XML encodes and decodes XML documents. The json struct tags are used for
+// the element names so the documents mirror the JSON ones, and fields left
+// out of JSON are left out of XML. Lists are encoded as item elements inside
+// the element of the list. The root element is named by the tag of an
+// XMLName field or after the type. Unknown elements are rejected when
+// decoding.
+type XML struct{}
+
+// MediaType implements the Codec interface.
+func (XML) MediaType() string {
+	return "application/xml"
+}
+
+// Encode implements the Codec interface.
+func (XML) Encode(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	enc := xml.NewEncoder(w)
+	if err := encodeXML(enc, xmlRoot(reflect.TypeOf(v)), reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// Decode implements the Codec interface.
+func (XML) Decode(r io.Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("xml: decode requires a non-nil pointer")
+	}
+
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			return decodeXML(dec, rv.Elem(), "")
+		}
+	}
+}
+
+// MessagePack encodes and decodes MessagePack documents. The json struct
+// tags are used for the field names so the documents mirror the JSON ones.
+type MessagePack struct{}
+
+// MediaType implements the Codec interface.
+func (MessagePack) MediaType() string {
+	return "application/msgpack"
+}
+
+// Encode implements the Codec interface.
+func (MessagePack) Encode(w io.Writer, v interface{}) error {
+	enc := msgpack.NewEncoder(w)
+	enc.SetCustomStructTag("json")
+	return enc.Encode(v)
+}
+
+// Decode implements the Codec interface.
+func (MessagePack) Decode(r io.Reader, v interface{}) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	return dec.Decode(v)
+}
+
+// CSV encodes lists of structs as CSV documents with a header row named
+// after the json struct tags. Only list responses can be encoded and
+// requests can't be decoded.
+type CSV struct{}
+
+// MediaType implements the Codec interface.
+func (CSV) MediaType() string {
+	return "text/csv"
+}
+
+// Encode implements the Codec interface.
+func (CSV) Encode(w io.Writer, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return ErrUnsupported
+	}
+
+	rt := rv.Type().Elem()
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return ErrUnsupported
+	}
+
+	fields, header := csvFields(rt)
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	record := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		item := reflect.Indirect(rv.Index(i))
+		for j, idx := range fields {
+			if !item.IsValid() {
+				record[j] = ""
+				continue
+			}
+			record[j] = csvValue(item.Field(idx))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Decode implements the Codec interface.
+func (CSV) Decode(r io.Reader, v interface{}) error {
+	return ErrUnsupported
+}
+
+// csvFields returns the index and the name of the exported fields of a
+// struct that are not excluded from the json encoding.
+func csvFields(rt reflect.Type) ([]int, []string) {
+	var fields []int
+	var header []string
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name, _, ok := jsonField(f)
+		if !ok {
+			continue
+		}
+
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	return fields, header
+}
+
+// csvValue formats a field value for a CSV cell. Lists are joined with a
+// semicolon.
+func csvValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch val := v.Interface().(type) {
+	case time.Time:
+		return val.Format(time.RFC3339)
+	case []byte:
+		return string(val)
+	case encoding.TextMarshaler:
+		b, err := val.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = csvValue(v.Index(i))
+		}
+		return strings.Join(items, ";")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
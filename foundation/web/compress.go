@@ -0,0 +1,265 @@
+package web
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoder compresses a response body. Encoders are reset and reused across
+// responses since creating them is costly.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// zstdEncoder adapts the zstd encoder whose Reset doesn't match the one of
+// the encoder interface.
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+// Reset implements the encoder interface.
+func (e zstdEncoder) Reset(w io.Writer) {
+	e.Encoder.Reset(w)
+}
+
+// encodings lists the supported content codings in order of preference. A
+// pool returns nil when it can't create an encoder, the next coding accepted
+// by the client is used instead.
+var encodings = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"zstd", &sync.Pool{New: func() interface{} {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil
+		}
+		return zstdEncoder{enc}
+	}}},
+	{"gzip", &sync.Pool{New: func() interface{} {
+		return gzip.NewWriter(nil)
+	}}},
+}
+
+// Compress compresses response bodies with the content coding preferred in
+// the Accept-Encoding header of the request. Only bodies of the listed media
+// types which reach the minimum size are compressed since smaller bodies
+// don't gain enough to be worth it. A body which is flushed before it
+// reaches the minimum size, like the ones sent by Stream, is compressed as
+// soon as it is flushed since its final size can't be known.
+//
+// The status code still reaches the context with SetStatusCode as the
+// status is only held back until it is known whether the body is compressed.
+func Compress(minSize int, mediaTypes ...string) Middleware {
+	types := make(map[string]bool)
+	for _, mt := range mediaTypes {
+		types[mt] = true
+	}
+
+	// This is the actual middleware function to be executed.
+	m := func(handler Handler) Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			codings := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+			if len(codings) == 0 || r.Method == http.MethodHead {
+				return handler(ctx, w, r)
+			}
+
+			cw := compressWriter{
+				ResponseWriter: w,
+				codings:        codings,
+				minSize:        minSize,
+				types:          types,
+			}
+			defer cw.close()
+
+			return handler(ctx, &cw, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// acceptedEncodings returns the indexes of the supported content codings the
+// client accepts in the Accept-Encoding header, from the highest quality to
+// the lowest.
+func acceptedEncodings(acceptEncoding string) []int {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		qs[coding] = q
+	}
+
+	// A coding which isn't listed gets the quality of the wildcard.
+	var codings []int
+	for i, enc := range encodings {
+		q, exists := qs[enc.name]
+		if !exists {
+			q = qs["*"]
+		}
+		qs[enc.name] = q
+		if q > 0 {
+			codings = append(codings, i)
+		}
+	}
+	sort.SliceStable(codings, func(i, j int) bool {
+		return qs[encodings[codings[i]].name] > qs[encodings[codings[j]].name]
+	})
+
+	return codings
+}
+
+// compressWriter holds back the status code and the start of the body until
+// it can decide whether the body is compressed.
+type compressWriter struct {
+	http.ResponseWriter
+	codings []int
+	minSize int
+	types   map[string]bool
+
+	status  int
+	buf     []byte
+	decided bool
+	coding  int
+	enc     encoder
+}
+
+// WriteHeader implements the http.ResponseWriter interface.
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+// Write implements the http.ResponseWriter interface.
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) < cw.minSize {
+		return len(p), nil
+	}
+
+	if err := cw.decide(true); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush implements the http.Flusher interface.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(true); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// decide sends the status code and the body held back, compressed when the
+// body is large enough and of a media type which is compressed.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+
+	h := cw.Header()
+	if large && cw.compressible() {
+		for _, coding := range cw.codings {
+			enc, ok := encodings[coding].pool.Get().(encoder)
+			if !ok {
+				continue
+			}
+			enc.Reset(cw.ResponseWriter)
+			cw.enc, cw.coding = enc, coding
+
+			h.Set("Content-Encoding", encodings[coding].name)
+			h.Del("Content-Length")
+			break
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+	return err
+}
+
+// compressible returns true if the response can be compressed.
+func (cw *compressWriter) compressible() bool {
+	switch {
+	case cw.status < http.StatusOK, cw.status == http.StatusNoContent, cw.status == http.StatusNotModified:
+		return false
+	case cw.Header().Get("Content-Encoding") != "":
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(cw.Header().Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return cw.types[mediaType]
+}
+
+// close sends what is left of the response once the handler returned.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		encodings[cw.coding].pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
@@ -12,11 +12,16 @@ type ctxKey int
 // key is how request values are stored/retrieved.
 const key ctxKey = 1
 
-// Values represent state for each request.
+// Values represent state for each request. The subject and actor identify
+// the caller once the request has been authenticated.
 type Values struct {
 	TraceID    string
 	Now        time.Time
 	StatusCode int
+	Subject    string
+	Actor      string
+
+	accept string
 }
 
 // GetValues returns the values from the context.
@@ -45,4 +50,15 @@ func SetStatusCode(ctx context.Context, statusCode int) error {
 	}
 	v.StatusCode = statusCode
 	return nil
-}
\ No newline at end of file
+}
+
+// SetIdentity sets the subject and actor of the caller back into the context.
+func SetIdentity(ctx context.Context, subject string, actor string) error {
+	v, ok := ctx.Value(key).(*Values)
+	if !ok {
+		return errors.New("web value missing from context")
+	}
+	v.Subject = subject
+	v.Actor = actor
+	return nil
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dimfeld/httptreemux/v5"
+)
+
+// Group represents a set of routes sharing a path prefix and middleware.
+// Groups can be nested, a nested group adds its prefix and middleware to the
+// ones of its parent. A group can have its own handlers for requests that
+// don't match any of its routes.
+type Group struct {
+	app              *App
+	prefix           string
+	mw               []Middleware
+	notFound         http.HandlerFunc
+	methodNotAllowed http.HandlerFunc
+}
+
+// Group constructs a group of routes for the specified path prefix. The
+// middleware runs after the application's general middleware and before
+// any route specific middleware.
+func (a *App) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{
+		app:    a,
+		prefix: strings.TrimSuffix(prefix, "/"),
+		mw:     mw,
+	}
+}
+
+// Group constructs a group nested in this group.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	nested := make([]Middleware, 0, len(g.mw)+len(mw))
+	nested = append(nested, g.mw...)
+	nested = append(nested, mw...)
+
+	return &Group{
+		app:    g.app,
+		prefix: g.prefix + strings.TrimSuffix(prefix, "/"),
+		mw:     nested,
+	}
+}
+
+// Handle sets a handler function for a given HTTP method and path relative
+// to the prefix of the group.
+func (g *Group) Handle(method string, path string, handler Handler, mw ...Middleware) {
+
+	// First wrap handler specific middleware around this handler, then the
+	// middleware of the group.
+	handler = wrapMiddleware(mw, handler)
+	handler = wrapMiddleware(g.mw, handler)
+
+	g.app.handle(method, g.prefix+path, handler)
+}
+
+// NotFound sets the handler for requests whose path is under the prefix of
+// the group but doesn't match any route. Nested groups use this handler
+// unless they set their own.
+func (g *Group) NotFound(handler Handler) {
+	g.notFound = g.app.httpHandler(wrapMiddleware(g.mw, handler))
+	g.app.addFallback(g)
+}
+
+// MethodNotAllowed sets the handler for requests whose path matches a route
+// of the group but not its method. The Allow header is set before the
+// handler is called. Nested groups use this handler unless they set their
+// own.
+func (g *Group) MethodNotAllowed(handler Handler) {
+	g.methodNotAllowed = g.app.httpHandler(wrapMiddleware(g.mw, handler))
+	g.app.addFallback(g)
+}
+
+// contains returns true if the path is under the prefix of the group.
+func (g *Group) contains(path string) bool {
+	return g.prefix == "" || path == g.prefix || strings.HasPrefix(path, g.prefix+"/")
+}
+
+// =============================================================================
+
+// addFallback records a group with its own handlers for unmatched requests.
+// The groups are kept sorted with the longest prefix first so the most
+// specific group is found first.
+func (a *App) addFallback(g *Group) {
+	for _, fg := range a.fallback {
+		if fg == g {
+			return
+		}
+	}
+
+	a.fallback = append(a.fallback, g)
+	sort.SliceStable(a.fallback, func(i, j int) bool {
+		return len(a.fallback[i].prefix) > len(a.fallback[j].prefix)
+	})
+}
+
+// notFound dispatches a request that doesn't match a route to the most
+// specific group that handles it.
+func (a *App) notFound(w http.ResponseWriter, r *http.Request) {
+	for _, g := range a.fallback {
+		if g.notFound != nil && g.contains(r.URL.Path) {
+			g.notFound(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// methodNotAllowed dispatches a request that matches a route but not its
+// method to the most specific group that handles it.
+func (a *App) methodNotAllowed(w http.ResponseWriter, r *http.Request, methods map[string]httptreemux.HandlerFunc) {
+	allow := make([]string, 0, len(methods))
+	for m := range methods {
+		allow = append(allow, m)
+	}
+	sort.Strings(allow)
+	w.Header().Set("Allow", strings.Join(allow, ", "))
+
+	for _, g := range a.fallback {
+		if g.methodNotAllowed != nil && g.contains(r.URL.Path) {
+			g.methodNotAllowed(w, r)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
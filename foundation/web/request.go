@@ -1,8 +1,16 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/dimfeld/httptreemux/v5"
 )
@@ -13,16 +21,182 @@ func Param(r *http.Request, key string) string {
 	return m[key]
 }
 
-// Decode reads the body of an HTTP request looking for a JSON document. The
+// Set of errors returned when the body of a request can't be read.
+var (
+	ErrUnsupportedMediaType = errors.New("media type is not supported")
+	ErrBodyTooLarge         = errors.New("request body too large")
+)
+
+// DecodeError describes why the body of a request could not be decoded.
+// The field and offset are set when the codec reports them.
+type DecodeError struct {
+	Field  string
+	Offset int64
+	Err    error
+}
+
+// Error is the implementation of the error interface.
+func (de *DecodeError) Error() string {
+	msg := "decoding body"
+	if de.Field != "" {
+		msg += fmt.Sprintf(": field %q", de.Field)
+	}
+	if de.Offset > 0 {
+		msg += fmt.Sprintf(": offset %d", de.Offset)
+	}
+	return msg + ": " + de.Err.Error()
+}
+
+// Unwrap returns the error reported by the codec.
+func (de *DecodeError) Unwrap() error {
+	return de.Err
+}
+
+// validator is implemented by values which can check themselves once they
+// were decoded.
+type validator interface {
+	Validate() error
+}
+
+// Decode reads the body of an HTTP request with the codec registered for its
+// Content-Type. A request without a Content-Type is decoded as JSON. The
 // body is decoded into the provided value.
 //
-// If the provided value is a struct then it is checked for validation tags.
+// If the provided value implements a Validate method it is called once the
+// value was decoded and its error is returned as is.
 func Decode(r *http.Request, val interface{}) error {
-	decoder := json.NewDecoder(r.Body)
-	decoder.DisallowUnknownFields()
-	if err := decoder.Decode(val); err != nil {
-		return err
+	codec := registered()[0]
+
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("content type %q: %w", ct, ErrUnsupportedMediaType)
+		}
+
+		codec = nil
+		for _, c := range registered() {
+			if c.MediaType() == mediaType {
+				codec = c
+				break
+			}
+		}
+		if codec == nil {
+			return fmt.Errorf("content type %q: %w", mediaType, ErrUnsupportedMediaType)
+		}
+	}
+
+	if err := codec.Decode(r.Body, val); err != nil {
+		switch {
+		case errors.Is(err, ErrUnsupported):
+			return fmt.Errorf("content type %q: %w", codec.MediaType(), ErrUnsupportedMediaType)
+		case errors.Is(err, ErrBodyTooLarge):
+			return err
+		}
+		return decodeError(err)
+	}
+
+	if v, ok := val.(validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// decodeError converts the error of a codec into a DecodeError, pulling out
+// the position of the failure where the codec reports it.
+func decodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var xmlErr *xml.SyntaxError
+	var fieldErr *fieldError
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Offset: syntaxErr.Offset, Err: errors.New("invalid syntax")}
+
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Field:  typeErr.Field,
+			Offset: typeErr.Offset,
+			Err:    fmt.Errorf("expected %s but got %s", typeErr.Type, typeErr.Value),
+		}
+
+	case errors.As(err, &xmlErr):
+		return &DecodeError{Err: fmt.Errorf("invalid syntax on line %d", xmlErr.Line)}
+
+	case errors.As(err, &fieldErr):
+		return &DecodeError{Field: fieldErr.field, Err: fieldErr.err}
+
+	case errors.Is(err, io.EOF):
+		return &DecodeError{Err: errors.New("body is empty")}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &DecodeError{Err: errors.New("body is truncated")}
+
+	// The json package doesn't export a type for unknown fields.
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field, uerr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+		if uerr != nil {
+			field = ""
+		}
+		return &DecodeError{Field: field, Err: errors.New("unknown field")}
+	}
+
+	return &DecodeError{Err: err}
+}
+
+// LimitBody returns a middleware which limits the size of request bodies.
+// Reading past the limit fails with ErrBodyTooLarge. A route can use it to
+// replace the limit set for the app, and a limit of zero or less leaves the
+// body unbounded.
+func LimitBody(limit int64) Middleware {
+	m := func(handler Handler) Handler {
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			body := r.Body
+			if lb, ok := body.(*limitedBody); ok {
+				body = lb.ReadCloser
+			}
+
+			if limit > 0 && body != nil {
+				body = &limitedBody{ReadCloser: body, limit: limit}
+			}
+			r.Body = body
+
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// limitedBody fails reads once more than the limit was read from the body.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+// Read implements the io.Reader interface.
+func (lb *limitedBody) Read(p []byte) (int, error) {
+	if lb.read > lb.limit {
+		return 0, fmt.Errorf("limit of %d bytes: %w", lb.limit, ErrBodyTooLarge)
+	}
+
+	// Ask for one more byte than allowed so a body of exactly the limit
+	// can still be read to its end.
+	if max := lb.limit + 1 - lb.read; int64(len(p)) > max {
+		p = p[:max]
+	}
+
+	n, err := lb.ReadCloser.Read(p)
+	lb.read += int64(n)
+	if lb.read > lb.limit {
+		return n, fmt.Errorf("limit of %d bytes: %w", lb.limit, ErrBodyTooLarge)
+	}
+
+	return n, err
+}
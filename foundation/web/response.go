@@ -1,37 +1,222 @@
 package web
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
-	// Set the status code for the request logger middleware.
-	SetStatusCode(ctx, statusCode)
+// ErrNotAcceptable is returned when none of the media types the client
+// accepts can represent the response.
+var ErrNotAcceptable = errors.New("none of the accepted media types are supported")
 
+// ContentTyper is implemented by values which refine the media type of the
+// codec they are encoded with, like an error document sent as
+// application/problem+json instead of application/json.
+type ContentTyper interface {
+	ContentType(mediaType string) string
+}
+
+// Respond encodes the data with the codec of the most preferred media type
+// the client accepts and writes it with the status code. The default codec
+// is used when none of the accepted codecs can represent the data, like a
+// single value asked for as CSV. Requests accepting none of the media types
+// are rejected before the handler runs, see acceptCheck.
+func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statusCode int) error {
 	// If there is nothing to marshal then set status code and return.
 	if statusCode == http.StatusNoContent {
+		SetStatusCode(ctx, statusCode)
 		w.WriteHeader(statusCode)
 		return nil
 	}
 
-	// Convert the response value to JSON.
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return err
+	var accept string
+	if v, err := GetValues(ctx); err == nil {
+		accept = v.accept
 	}
 
+	// Convert the response value with the first codec able to represent it.
+	var body bytes.Buffer
+	var codec Codec
+	for _, c := range acceptable(accept) {
+		err := c.Encode(&body, data)
+		if errors.Is(err, ErrUnsupported) {
+			body.Reset()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		codec = c
+		break
+	}
+
+	if codec == nil {
+		codec = registered()[0]
+		if err := codec.Encode(&body, data); err != nil {
+			return err
+		}
+	}
+
+	// Set the status code for the request logger middleware.
+	SetStatusCode(ctx, statusCode)
+
 	// Set the content type and headers once we know marshaling has succeeded.
-	w.Header().Set("Content-Type", "application/json")
+	contentType := codec.MediaType()
+	if ct, ok := data.(ContentTyper); ok {
+		contentType = ct.ContentType(contentType)
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
 
 	// Write the status code to the response.
 	w.WriteHeader(statusCode)
 
 	// Send the result back to the client.
-	if _, err := w.Write(jsonData); err != nil {
+	if _, err := w.Write(body.Bytes()); err != nil {
 		return err
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// acceptCheck rejects the request with ErrNotAcceptable before the handler
+// runs when the client accepts none of the media types the app can respond
+// with, so the handler doesn't act on a request it can't answer.
+func acceptCheck(handler Handler) Handler {
+	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		offers := []string{streamNDJSON}
+		for _, c := range registered() {
+			offers = append(offers, c.MediaType())
+		}
+
+		accept := r.Header.Get("Accept")
+		if len(negotiate(accept, offers)) == 0 {
+			return fmt.Errorf("accept %q: %w", accept, ErrNotAcceptable)
+		}
+
+		return handler(ctx, w, r)
+	}
+
+	return h
+}
+
+// acceptable returns the registered codecs matching the Accept header, in
+// the order of preference of the client. No header accepts every codec.
+func acceptable(accept string) []Codec {
+	byType := make(map[string]Codec)
+	var offers []string
+	for _, c := range registered() {
+		byType[c.MediaType()] = c
+		offers = append(offers, c.MediaType())
+	}
+
+	var list []Codec
+	for _, mediaType := range negotiate(accept, offers) {
+		list = append(list, byType[mediaType])
+	}
+
+	return list
+}
+
+// negotiate returns the offered media types matching the Accept header, in
+// the order of preference of the client. No header accepts every offer.
+//
+// As defined by RFC 9110 the quality of an offer is set by the most specific
+// range matching it, so "text/csv;q=0, */*" accepts everything but CSV.
+// Offers of equal quality are ordered by how specific their range is and
+// then by the position of the range in the header.
+func negotiate(accept string, offers []string) []string {
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qs, exists := params["q"]; exists {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+	}
+	if strings.TrimSpace(accept) == "" {
+		ranges = []mediaRange{{mediaType: "*/*", q: 1}}
+	}
+
+	type match struct {
+		offer       string
+		q           float64
+		specificity int
+		position    int
+	}
+
+	var matches []match
+	for _, offer := range offers {
+		best := match{specificity: -1}
+		for i, mr := range ranges {
+			spec := specificity(mr.mediaType)
+			if spec > best.specificity && matchMediaType(mr.mediaType, offer) {
+				best = match{offer: offer, q: mr.q, specificity: spec, position: i}
+			}
+		}
+		if best.specificity >= 0 && best.q > 0 {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		switch {
+		case matches[i].q != matches[j].q:
+			return matches[i].q > matches[j].q
+		case matches[i].specificity != matches[j].specificity:
+			return matches[i].specificity > matches[j].specificity
+		}
+		return matches[i].position < matches[j].position
+	})
+
+	list := make([]string, len(matches))
+	for i, m := range matches {
+		list[i] = m.offer
+	}
+
+	return list
+}
+
+// specificity ranks a media range, a range naming the type and subtype is
+// more specific than one naming the type which is more specific than */*.
+func specificity(mediaRange string) int {
+	switch {
+	case mediaRange == "*/*":
+		return 0
+	case strings.HasSuffix(mediaRange, "/*"):
+		return 1
+	}
+	return 2
+}
+
+// matchMediaType returns true if the media type is within the media range.
+func matchMediaType(mediaRange string, mediaType string) bool {
+	switch {
+	case mediaRange == "*/*":
+		return true
+	case strings.HasSuffix(mediaRange, "/*"):
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))
+	}
+	return mediaRange == mediaType
+}
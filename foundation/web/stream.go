@@ -0,0 +1,170 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Set of media types a collection can be streamed as.
+const (
+	streamJSON   = "application/json"
+	streamNDJSON = "application/x-ndjson"
+)
+
+// streamFlush is the number of values written between flushes of the
+// response to the client.
+const streamFlush = 100
+
+// connKey is how the connection of a request is stored/retrieved.
+const connKey ctxKey = 2
+
+// conn represents the connection a request arrived on along with the write
+// timeout of the server.
+type conn struct {
+	net.Conn
+	writeTimeout time.Duration
+}
+
+// ConnContext returns the function to set as the ConnContext of the server
+// so streamed responses aren't cut off by the write timeout of the server.
+// The timeout is applied again to each batch of values instead of the whole
+// response, so a stream goes on for as long as the client keeps reading it.
+// Only HTTP/1 connections are supported.
+func ConnContext(writeTimeout time.Duration) func(ctx context.Context, c net.Conn) context.Context {
+	f := func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, connKey, &conn{Conn: c, writeTimeout: writeTimeout})
+	}
+
+	return f
+}
+
+// extendWriteDeadline gives the connection of the request the write timeout
+// of the server again, starting now.
+func extendWriteDeadline(ctx context.Context) {
+	c, ok := ctx.Value(connKey).(*conn)
+	if !ok || c.writeTimeout <= 0 {
+		return
+	}
+	c.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+}
+
+// Iterator provides the values of a streamed response one at a time. It
+// returns io.EOF when there are no more values.
+type Iterator func() (interface{}, error)
+
+// Stream writes the values provided by the iterator as they are produced
+// instead of holding the collection in memory. The client chooses between a
+// JSON array and newline delimited JSON with the Accept header. The next
+// value is only read once the previous one was written to the connection,
+// and streaming stops when the context is cancelled because the client went
+// away. See ConnContext to stream for longer than the write timeout of the
+// server.
+//
+// Errors which happen once the response started are returned wrapped so
+// IsStreamAborted can tell there is no way left to respond to the client.
+func Stream(ctx context.Context, w http.ResponseWriter, next Iterator, statusCode int) error {
+	var accept string
+	if v, err := GetValues(ctx); err == nil {
+		accept = v.accept
+	}
+
+	offers := negotiate(accept, []string{streamJSON, streamNDJSON})
+	if len(offers) == 0 {
+		return fmt.Errorf("accept %q: %w", accept, ErrNotAcceptable)
+	}
+	ndjson := offers[0] == streamNDJSON
+
+	// Read the first value before writing anything so a failure to start
+	// the collection can still be reported with an error response.
+	val, nextErr := next()
+	if nextErr != nil && !errors.Is(nextErr, io.EOF) {
+		return nextErr
+	}
+
+	// Set the status code for the request logger middleware.
+	SetStatusCode(ctx, statusCode)
+
+	w.Header().Set("Content-Type", offers[0])
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(statusCode)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	if !ndjson {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return &streamError{err}
+		}
+	}
+
+	for n := 0; !errors.Is(nextErr, io.EOF); n++ {
+		if err := ctx.Err(); err != nil {
+			return &streamError{err}
+		}
+
+		if n%streamFlush == 0 {
+			extendWriteDeadline(ctx)
+		}
+
+		if !ndjson && n > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return &streamError{err}
+			}
+		}
+		if err := enc.Encode(val); err != nil {
+			return &streamError{err}
+		}
+
+		if flusher != nil && n%streamFlush == 0 {
+			flusher.Flush()
+		}
+
+		val, nextErr = next()
+		if nextErr != nil && !errors.Is(nextErr, io.EOF) {
+			return &streamError{nextErr}
+		}
+	}
+
+	extendWriteDeadline(ctx)
+
+	if !ndjson {
+		if _, err := io.WriteString(w, "]"); err != nil {
+			return &streamError{err}
+		}
+	}
+
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// streamError is a type used to report a failure after a streamed response
+// was started.
+type streamError struct {
+	err error
+}
+
+// Error is the implementation of the error interface.
+func (se *streamError) Error() string {
+	return "streaming response: " + se.err.Error()
+}
+
+// Unwrap returns the error which stopped the stream.
+func (se *streamError) Unwrap() error {
+	return se.err
+}
+
+// IsStreamAborted checks to see if the error stopped a streamed response
+// after the status code was written.
+func IsStreamAborted(err error) bool {
+	var se *streamError
+	return errors.As(err, &se)
+}
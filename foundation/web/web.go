@@ -23,6 +23,7 @@ type App struct {
 	otmux    http.Handler
 	shutdown chan os.Signal
 	mw       []Middleware
+	fallback []*Group
 }
 
 // NewApp - creates an App value that handle a set of routes for the application.
@@ -36,12 +37,19 @@ func NewApp(shutdown chan os.Signal, mw ...Middleware) *App {
 
 	mux := httptreemux.NewContextMux()
 
-	return &App{
+	a := App{
 		mux:      mux,
 		otmux:    otelhttp.NewHandler(mux, "request"),
 		shutdown: shutdown,
 		mw:       mw,
 	}
+
+	// Requests that don't match a route are handled by the group the path
+	// belongs to when it has its own handlers.
+	mux.NotFoundHandler = a.notFound
+	mux.MethodNotAllowedHandler = a.methodNotAllowed
+
+	return &a
 }
 
 // SignalShutdown - used for gracefully shutdown the app.
@@ -57,11 +65,47 @@ func (a *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.otmux.ServeHTTP(w, r)
 }
 
+// Handle sets a handler function for a given HTTP method and path pair
+// to the application server mux. The group is a plain prefix, use Group to
+// share middleware between a set of routes.
 func (a *App) Handle(method, group, path string, handler Handler, mw ...Middleware) {
 
 	// First wrap handler specific middleware around this handler.
 	handler = wrapMiddleware(mw, handler)
 
+	finalPath := path
+	if group != "" {
+		finalPath = "/" + group + path
+	}
+
+	a.handle(method, finalPath, handler)
+}
+
+// Options sets the handler for OPTIONS requests to the routes that don't have
+// their own OPTIONS route, such as the preflight requests of browsers. Only
+// the application's general middleware is added to the handler since these
+// requests are answered before a client is authenticated. Without a handler
+// these requests are answered as not allowed.
+func (a *App) Options(handler Handler) {
+	h := a.httpHandler(handler)
+	a.mux.OptionsHandler = func(w http.ResponseWriter, r *http.Request, _ map[string]string) {
+		h(w, r)
+	}
+}
+
+// handle registers the handler with the mux once the application's general
+// middleware has been added to the handler chain. The Accept header is
+// checked before the route's own middleware runs.
+func (a *App) handle(method, path string, handler Handler) {
+
+	// original call to library.
+	a.mux.Handle(method, path, a.httpHandler(acceptCheck(handler)))
+}
+
+// httpHandler adds the application's general middleware to the handler and
+// adapts it to the standard library.
+func (a *App) httpHandler(handler Handler) http.HandlerFunc {
+
 	// Add the application's general middleware to the handler chain.
 	handler = wrapMiddleware(a.mw, handler)
 
@@ -76,6 +120,7 @@ func (a *App) Handle(method, group, path string, handler Handler, mw ...Middlewa
 		v := Values{
 			TraceID: span.SpanContext().TraceID().String(),
 			Now:     time.Now().UTC(),
+			accept:  r.Header.Get("Accept"),
 		}
 		ctx = context.WithValue(ctx, key, &v)
 		// Call the wrapped handler functions.
@@ -86,10 +131,5 @@ func (a *App) Handle(method, group, path string, handler Handler, mw ...Middlewa
 		// POST CODE PROCCESSING.
 	}
 
-	finalPath := path
-	if group != "" {
-		finalPath = "/" + group + path
-	}
-	// original call to library.
-	a.mux.Handle(method, finalPath, h)
+	return h
 }
@@ -0,0 +1,877 @@
+package web_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/asishcse60/service/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestGroup(t *testing.T) {
+	app := web.NewApp(make(chan os.Signal, 1))
+
+	// trace records the name of the middleware in a header so the order the
+	// middleware runs in can be checked.
+	trace := func(name string) web.Middleware {
+		return func(handler web.Handler) web.Handler {
+			return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+				w.Header().Add("X-Trace", name)
+				return handler(ctx, w, r)
+			}
+		}
+	}
+	respond := func(status int) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			return web.Respond(ctx, w, nil, status)
+		}
+	}
+
+	v1 := app.Group("/v1", trace("v1"))
+	v1.NotFound(respond(http.StatusTeapot))
+	v1.MethodNotAllowed(respond(http.StatusConflict))
+
+	admin := v1.Group("/admin", trace("admin"))
+	admin.Handle(http.MethodGet, "/users", respond(http.StatusOK), trace("route"))
+	admin.NotFound(respond(http.StatusGone))
+
+	v1.Handle(http.MethodGet, "/ping", respond(http.StatusNoContent))
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to group routes under a prefix with shared middleware.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen calling a route of a nested group.", testID)
+		{
+			w := serve(http.MethodGet, "/v1/admin/users")
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for the response : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for the response.", success, testID)
+
+			if got := strings.Join(w.Header()["X-Trace"], ","); got != "v1,admin,route" {
+				t.Fatalf("\t%s\tTest %d:\tShould run the middleware from the outer group in : %s", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould run the middleware from the outer group in.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen calling a route that does not exist.", testID)
+		{
+			if w := serve(http.MethodGet, "/v1/missing"); w.Code != http.StatusTeapot {
+				t.Fatalf("\t%s\tTest %d:\tShould use the handler of the group : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the handler of the group.", success, testID)
+
+			if w := serve(http.MethodGet, "/v1/admin/missing"); w.Code != http.StatusGone {
+				t.Fatalf("\t%s\tTest %d:\tShould use the handler of the nested group : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the handler of the nested group.", success, testID)
+
+			if w := serve(http.MethodGet, "/v2/missing"); w.Code != http.StatusNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould use the default handler outside of a group : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the default handler outside of a group.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen calling a route with the wrong method.", testID)
+		{
+			w := serve(http.MethodPost, "/v1/admin/users")
+			if w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould use the handler of the parent group : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the handler of the parent group.", success, testID)
+
+			if allow := w.Header().Get("Allow"); !strings.Contains(allow, http.MethodGet) {
+				t.Fatalf("\t%s\tTest %d:\tShould list the allowed methods : %s", failed, testID, allow)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the allowed methods.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen calling a route with the OPTIONS method.", testID)
+		{
+			if w := serve(http.MethodOptions, "/v1/admin/users"); w.Code != http.StatusConflict {
+				t.Fatalf("\t%s\tTest %d:\tShould not be allowed without an options handler : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be allowed without an options handler.", success, testID)
+
+			app.Options(respond(http.StatusNoContent))
+
+			w := serve(http.MethodOptions, "/v1/admin/users")
+			if w.Code != http.StatusNoContent {
+				t.Fatalf("\t%s\tTest %d:\tShould use the options handler : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the options handler.", success, testID)
+
+			if got := w.Header()["X-Trace"]; len(got) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not run the middleware of the group : %s", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not run the middleware of the group.", success, testID)
+
+			if w := serve(http.MethodOptions, "/v1/missing"); w.Code != http.StatusTeapot {
+				t.Fatalf("\t%s\tTest %d:\tShould use the not found handler for unknown routes : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the not found handler for unknown routes.", success, testID)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	type product struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	// status converts the negotiation errors into their status codes, which
+	// is the job of the error middleware in the business layer.
+	status := func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			err := handler(ctx, w, r)
+			switch {
+			case errors.Is(err, web.ErrNotAcceptable):
+				w.WriteHeader(http.StatusNotAcceptable)
+				return nil
+			case errors.Is(err, web.ErrUnsupportedMediaType):
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return nil
+			}
+			return err
+		}
+	}
+
+	app := web.NewApp(make(chan os.Signal, 1), status)
+
+	var created int
+	app.Handle(http.MethodGet, "", "/products", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		list := []product{{ID: "1", Name: "Comic Books"}, {ID: "2", Name: "McDonalds Toys"}}
+		return web.Respond(ctx, w, list, http.StatusOK)
+	})
+	app.Handle(http.MethodGet, "", "/products/1", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		return web.Respond(ctx, w, product{ID: "1", Name: "Comic Books"}, http.StatusOK)
+	})
+	app.Handle(http.MethodPost, "", "/products", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var p product
+		if err := web.Decode(r, &p); err != nil {
+			return err
+		}
+		created++
+		return web.Respond(ctx, w, p, http.StatusCreated)
+	})
+
+	serve := func(method string, path string, body string, header string, value string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if value != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to select the codec by media type.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the client doesn't send an Accept header.", testID)
+		{
+			w := serve(http.MethodGet, "/products/1", "", "Accept", "")
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with JSON : %s", failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with JSON.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the client prefers XML.", testID)
+		{
+			w := serve(http.MethodGet, "/products/1", "", "Accept", "application/json;q=0.5, application/xml")
+			if ct := w.Header().Get("Content-Type"); ct != "application/xml" {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with XML : %s", failed, testID, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with XML.", success, testID)
+
+			if !strings.Contains(w.Body.String(), "Comic Books") {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the product : %s", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould encode the product.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen the client asks for CSV.", testID)
+		{
+			w := serve(http.MethodGet, "/products", "", "Accept", "text/csv")
+			if w.Code != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 200 for a list : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 200 for a list.", success, testID)
+
+			exp := "id,name\n1,Comic Books\n2,McDonalds Toys\n"
+			if w.Body.String() != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould write a header and a row per item : %q", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould write a header and a row per item.", success, testID)
+
+			w = serve(http.MethodGet, "/products/1", "", "Accept", "text/csv")
+			if ct := w.Header().Get("Content-Type"); w.Code != http.StatusOK || ct != "application/json" {
+				t.Fatalf("\t%s\tTest %d:\tShould fall back to JSON for a single value : %v %s", failed, testID, w.Code, ct)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fall back to JSON for a single value.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the client sends a body.", testID)
+		{
+			body := `<product><id>3</id><name>Puzzles</name></product>`
+			w := serve(http.MethodPost, "/products", body, "Content-Type", "application/xml")
+			if w.Code != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould decode XML : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode XML.", success, testID)
+
+			if !strings.Contains(w.Body.String(), `"name":"Puzzles"`) {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with the decoded product : %s", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with the decoded product.", success, testID)
+
+			if w := serve(http.MethodPost, "/products", "id=3", "Content-Type", "application/x-www-form-urlencoded"); w.Code != http.StatusUnsupportedMediaType {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 415 for an unknown type : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 415 for an unknown type.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen the client accepts none of the media types.", testID)
+		{
+			before := created
+			body := `{"id":"4","name":"Kites"}`
+			r := httptest.NewRequest(http.MethodPost, "/products", strings.NewReader(body))
+			r.Header.Set("Accept", "image/png")
+			w := httptest.NewRecorder()
+			app.ServeHTTP(w, r)
+
+			if w.Code != http.StatusNotAcceptable {
+				t.Fatalf("\t%s\tTest %d:\tShould receive a status code of 406 : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive a status code of 406.", success, testID)
+
+			if created != before {
+				t.Fatalf("\t%s\tTest %d:\tShould not run the handler.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not run the handler.", success, testID)
+		}
+
+		testID = 5
+		t.Logf("\tTest %d:\tWhen a value has fields left out of JSON.", testID)
+		{
+			type account struct {
+				Email        string    `json:"email"`
+				Roles        []string  `json:"roles"`
+				PasswordHash []byte    `json:"-"`
+				TokenVersion int       `json:"-"`
+				DateCreated  time.Time `json:"date_created"`
+				Note         string    `json:"note,omitempty"`
+			}
+			acc := account{
+				Email:        "admin@example.com",
+				Roles:        []string{"ADMIN", "USER"},
+				PasswordHash: []byte("$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$aGFzaA"),
+				TokenVersion: 3,
+				DateCreated:  time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+			}
+
+			var buf bytes.Buffer
+			if err := (web.XML{}).Encode(&buf, acc); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould encode the value : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould encode the value.", success, testID)
+
+			doc := buf.String()
+			if strings.Contains(doc, "argon2id") || strings.Contains(doc, "PasswordHash") || strings.Contains(doc, "TokenVersion") {
+				t.Fatalf("\t%s\tTest %d:\tShould leave out the fields left out of JSON : %s", failed, testID, doc)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave out the fields left out of JSON.", success, testID)
+
+			exp := "<account><email>admin@example.com</email><roles><item>ADMIN</item><item>USER</item></roles><date_created>2021-06-01T00:00:00Z</date_created></account>"
+			if !strings.HasSuffix(doc, exp) {
+				t.Fatalf("\t%s\tTest %d:\tShould name the elements like the JSON fields : %s", failed, testID, doc)
+			}
+			t.Logf("\t%s\tTest %d:\tShould name the elements like the JSON fields.", success, testID)
+
+			var got account
+			if err := (web.XML{}).Decode(&buf, &got); err != nil || got.Email != acc.Email || len(got.Roles) != 2 || !got.DateCreated.Equal(acc.DateCreated) {
+				t.Fatalf("\t%s\tTest %d:\tShould decode the document it encoded : %+v %v", failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould decode the document it encoded.", success, testID)
+		}
+	}
+}
+
+func TestAccept(t *testing.T) {
+	app := web.NewApp(make(chan os.Signal, 1))
+	app.Handle(http.MethodGet, "", "/products", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		list := []struct {
+			ID string `json:"id"`
+		}{{ID: "1"}}
+		return web.Respond(ctx, w, list, http.StatusOK)
+	})
+
+	tt := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{
+			name:   "excluding a type the wildcard matches",
+			accept: "text/csv;q=0, text/*",
+			want:   "",
+		},
+		{
+			name:   "excluding the default type",
+			accept: "application/json;q=0, */*",
+			want:   "application/xml",
+		},
+		{
+			name:   "ranking a type below its wildcard",
+			accept: "application/*, application/json;q=0.2",
+			want:   "application/xml",
+		},
+		{
+			name:   "ranking a type above the wildcard",
+			accept: "*/*;q=0.1, text/csv",
+			want:   "text/csv",
+		},
+		{
+			name:   "ranking a type below the wildcard",
+			accept: "*/*, application/json;q=0.5",
+			want:   "application/xml",
+		},
+	}
+
+	t.Log("Given the need to rank media types as defined by RFC 9110.")
+	{
+		for testID, tst := range tt {
+			t.Logf("\tTest %d:\tWhen %s.", testID, tst.name)
+			{
+				r := httptest.NewRequest(http.MethodGet, "/products", nil)
+				r.Header.Set("Accept", tst.accept)
+				w := httptest.NewRecorder()
+				app.ServeHTTP(w, r)
+
+				if tst.want == "" {
+					if w.Header().Get("Content-Type") != "" || w.Body.Len() != 0 {
+						t.Fatalf("\t%s\tTest %d:\tShould not respond with any media type : %s", failed, testID, w.Header().Get("Content-Type"))
+					}
+					t.Logf("\t%s\tTest %d:\tShould not respond with any media type.", success, testID)
+					continue
+				}
+
+				if ct := w.Header().Get("Content-Type"); ct != tst.want {
+					t.Fatalf("\t%s\tTest %d:\tShould respond with %s : %s", failed, testID, tst.want, ct)
+				}
+				t.Logf("\t%s\tTest %d:\tShould respond with %s.", success, testID, tst.want)
+			}
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	app := web.NewApp(make(chan os.Signal, 1))
+
+	// iterate provides the values and then fails with the error.
+	iterate := func(values []int, failure error) web.Iterator {
+		return func() (interface{}, error) {
+			if len(values) == 0 {
+				return nil, failure
+			}
+			v := values[0]
+			values = values[1:]
+			return v, nil
+		}
+	}
+
+	var streamErr error
+	stream := func(values []int, failure error) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			streamErr = web.Stream(ctx, w, iterate(values, failure), http.StatusOK)
+			if streamErr != nil && !web.IsStreamAborted(streamErr) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return nil
+		}
+	}
+
+	app.Handle(http.MethodGet, "", "/numbers", stream([]int{1, 2, 3}, io.EOF))
+	app.Handle(http.MethodGet, "", "/empty", stream(nil, io.EOF))
+	app.Handle(http.MethodGet, "", "/broken", stream(nil, errors.New("query failed")))
+	app.Handle(http.MethodGet, "", "/interrupted", stream([]int{1}, errors.New("connection lost")))
+
+	// slow takes longer to stream than the write timeout of the server.
+	app.Handle(http.MethodGet, "", "/slow", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		n := 0
+		next := func() (interface{}, error) {
+			if n == 400 {
+				return nil, io.EOF
+			}
+			n++
+			time.Sleep(time.Millisecond)
+			return n, nil
+		}
+		streamErr = web.Stream(ctx, w, next, http.StatusOK)
+		return nil
+	})
+
+	serve := func(path string, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to stream a collection.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the client asks for newline delimited JSON.", testID)
+		{
+			w := serve("/numbers", "application/x-ndjson")
+			if w.Body.String() != "1\n2\n3\n" {
+				t.Fatalf("\t%s\tTest %d:\tShould write a line per value : %q", failed, testID, w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould write a line per value.", success, testID)
+
+			if !w.Flushed {
+				t.Fatalf("\t%s\tTest %d:\tShould flush the response.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould flush the response.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the client doesn't state a preference.", testID)
+		{
+			var got []int
+			if err := json.Unmarshal(serve("/numbers", "").Body.Bytes(), &got); err != nil || len(got) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould write a JSON array : %v %v", failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write a JSON array.", success, testID)
+
+			if body := serve("/empty", "").Body.String(); body != "[]" {
+				t.Fatalf("\t%s\tTest %d:\tShould write an empty JSON array : %q", failed, testID, body)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write an empty JSON array.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen the iterator fails.", testID)
+		{
+			if w := serve("/broken", ""); w.Code != http.StatusInternalServerError {
+				t.Fatalf("\t%s\tTest %d:\tShould still be able to respond before the first value : %v", failed, testID, w.Code)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still be able to respond before the first value.", success, testID)
+
+			serve("/interrupted", "")
+			if !web.IsStreamAborted(streamErr) {
+				t.Fatalf("\t%s\tTest %d:\tShould report the stream was aborted : %v", failed, testID, streamErr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report the stream was aborted.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the client asks for an unsupported media type.", testID)
+		{
+			serve("/numbers", "text/csv")
+			if !errors.Is(streamErr, web.ErrNotAcceptable) {
+				t.Fatalf("\t%s\tTest %d:\tShould not be acceptable : %v", failed, testID, streamErr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be acceptable.", success, testID)
+		}
+
+		testID = 4
+		t.Logf("\tTest %d:\tWhen the stream outlives the write timeout of the server.", testID)
+		{
+			const writeTimeout = 250 * time.Millisecond
+
+			srv := httptest.NewUnstartedServer(app)
+			srv.Config.WriteTimeout = writeTimeout
+			srv.Config.ConnContext = web.ConnContext(writeTimeout)
+			srv.Start()
+			defer srv.Close()
+
+			r, err := http.NewRequest(http.MethodGet, srv.URL+"/slow", nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a request : %v", failed, testID, err)
+			}
+			r.Header.Set("Accept", "application/x-ndjson")
+
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send the request : %v", failed, testID, err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the whole stream : %v", failed, testID, err)
+			}
+			if lines := strings.Count(string(body), "\n"); lines != 400 {
+				t.Fatalf("\t%s\tTest %d:\tShould receive every value : %d", failed, testID, lines)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive every value.", success, testID)
+		}
+	}
+}
+
+// order is a value checking itself once it was decoded.
+type order struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+func (o order) Validate() error {
+	if o.Quantity < 1 {
+		return errors.New("quantity must be positive")
+	}
+	return nil
+}
+
+func TestDecode(t *testing.T) {
+	app := web.NewApp(make(chan os.Signal, 1), web.LimitBody(64))
+
+	var decodeErr error
+	decode := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		var o order
+		decodeErr = web.Decode(r, &o)
+		return nil
+	}
+
+	app.Handle(http.MethodPost, "", "/orders", decode)
+	app.Handle(http.MethodPost, "", "/imports", decode, web.LimitBody(1024))
+
+	serve := func(path string, body string) error {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		app.ServeHTTP(httptest.NewRecorder(), r)
+		return decodeErr
+	}
+
+	large := `{"item":"` + strings.Repeat("x", 100) + `","quantity":1}`
+
+	t.Log("Given the need to decode the body of a request.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the body is larger than the limit.", testID)
+		{
+			if err := serve("/orders", large); !errors.Is(err, web.ErrBodyTooLarge) {
+				t.Fatalf("\t%s\tTest %d:\tShould be too large : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be too large.", success, testID)
+
+			if err := serve("/imports", large); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould use the limit of the route : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the limit of the route.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the body is malformed.", testID)
+		{
+			var de *web.DecodeError
+			if err := serve("/orders", `{"item":"pen","quantity":"two"}`); !errors.As(err, &de) {
+				t.Fatalf("\t%s\tTest %d:\tShould get a decode error : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a decode error.", success, testID)
+
+			if de.Field != "quantity" || de.Offset == 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould point at the field and offset : %v", failed, testID, de)
+			}
+			t.Logf("\t%s\tTest %d:\tShould point at the field and offset.", success, testID)
+
+			if err := serve("/orders", `{"item":"pen","color":"red"}`); !errors.As(err, &de) || de.Field != "color" {
+				t.Fatalf("\t%s\tTest %d:\tShould name the unknown field : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould name the unknown field.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen an XML body is malformed.", testID)
+		{
+			serveXML := func(body string) error {
+				r := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+				r.Header.Set("Content-Type", "application/xml")
+				app.ServeHTTP(httptest.NewRecorder(), r)
+				return decodeErr
+			}
+
+			var de *web.DecodeError
+			if err := serveXML(`<order><item>pen</item><quantity>two</quantity></order>`); !errors.As(err, &de) || de.Field != "quantity" {
+				t.Fatalf("\t%s\tTest %d:\tShould point at the field : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould point at the field.", success, testID)
+
+			if err := serveXML(`<order><item>pen</item><color>red</color></order>`); !errors.As(err, &de) || de.Field != "color" {
+				t.Fatalf("\t%s\tTest %d:\tShould name the unknown field : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould name the unknown field.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen the value can check itself.", testID)
+		{
+			err := serve("/orders", `{"item":"pen","quantity":0}`)
+			var de *web.DecodeError
+			if err == nil || errors.As(err, &de) {
+				t.Fatalf("\t%s\tTest %d:\tShould return the validation error : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould return the validation error.", success, testID)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	app := web.NewApp(make(chan os.Signal, 1))
+
+	type params struct {
+		Page  int           `param:"page"`
+		Rows  int           `query:"rows" default:"20"`
+		Since time.Time     `query:"since"`
+		Wait  time.Duration `query:"wait"`
+		Tags  []string      `query:"tag"`
+	}
+
+	var got params
+	var bindErr error
+	app.Handle(http.MethodGet, "", "/items/:page", func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		got = params{}
+		bindErr = web.Bind(r, &got)
+		return nil
+	})
+
+	serve := func(path string) {
+		app.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	t.Log("Given the need to bind request parameters to a struct.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the parameters are valid.", testID)
+		{
+			serve("/items/3?since=2021-06-01T00:00:00Z&wait=5s&tag=a&tag=b")
+			if bindErr != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to bind the parameters : %v", failed, testID, bindErr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to bind the parameters.", success, testID)
+
+			exp := params{
+				Page:  3,
+				Rows:  20,
+				Since: time.Date(2021, time.June, 1, 0, 0, 0, 0, time.UTC),
+				Wait:  5 * time.Second,
+				Tags:  []string{"a", "b"},
+			}
+			if got.Page != exp.Page || got.Rows != exp.Rows || !got.Since.Equal(exp.Since) || got.Wait != exp.Wait || strings.Join(got.Tags, ",") != "a,b" {
+				t.Fatalf("\t%s\tTest %d:\tShould get the expected values : %+v", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the expected values.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the parameters are malformed.", testID)
+		{
+			serve("/items/first?rows=many&since=yesterday")
+
+			var perrs web.ParamErrors
+			if !errors.As(bindErr, &perrs) || len(perrs) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould report every parameter : %v", failed, testID, bindErr)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report every parameter.", success, testID)
+
+			if perrs[0].Param != "page" {
+				t.Fatalf("\t%s\tTest %d:\tShould name the parameter : %s", failed, testID, perrs[0].Param)
+			}
+			t.Logf("\t%s\tTest %d:\tShould name the parameter.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a field has a type that can't be bound.", testID)
+		{
+			var unsupported struct {
+				Limits map[string]int `query:"limits"`
+			}
+			r := httptest.NewRequest(http.MethodGet, "/items?limits=1", nil)
+
+			err := web.Bind(r, &unsupported)
+			var perrs web.ParamErrors
+			if err == nil || errors.As(err, &perrs) {
+				t.Fatalf("\t%s\tTest %d:\tShould fail without blaming the request : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fail without blaming the request.", success, testID)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	var status int
+	record := func(handler web.Handler) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			err := handler(ctx, w, r)
+			if v, verr := web.GetValues(ctx); verr == nil {
+				status = v.StatusCode
+			}
+			return err
+		}
+	}
+	app := web.NewApp(make(chan os.Signal, 1), record, web.Compress(100, "application/json", "application/x-ndjson"))
+
+	respond := func(data interface{}, status int) web.Handler {
+		return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			return web.Respond(ctx, w, data, status)
+		}
+	}
+	numbers := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		n := 0
+		next := func() (interface{}, error) {
+			if n == 3 {
+				return nil, io.EOF
+			}
+			n++
+			return n, nil
+		}
+		return web.Stream(ctx, w, next, http.StatusOK)
+	}
+
+	large := strings.Repeat("compress me ", 20)
+	app.Handle(http.MethodGet, "", "/large", respond(large, http.StatusCreated))
+	app.Handle(http.MethodGet, "", "/small", respond("small", http.StatusCreated))
+	app.Handle(http.MethodGet, "", "/empty", respond(nil, http.StatusNoContent))
+	app.Handle(http.MethodGet, "", "/numbers", numbers)
+
+	serve := func(path string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		app.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Log("Given the need to compress responses.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the client accepts gzip.", testID)
+		{
+			w := serve("/large", "Accept-Encoding", "gzip")
+			if w.Code != http.StatusCreated || w.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("\t%s\tTest %d:\tShould compress a large body with gzip : %v %v", failed, testID, w.Code, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould compress a large body with gzip.", success, testID)
+
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the body : %s", failed, testID, err)
+			}
+			var got string
+			if err := json.NewDecoder(zr).Decode(&got); err != nil || got != large {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the body : %q %v", failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decode the body.", success, testID)
+
+			if status != http.StatusCreated {
+				t.Fatalf("\t%s\tTest %d:\tShould still record the status code : %v", failed, testID, status)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still record the status code.", success, testID)
+
+			w = serve("/small", "Accept-Encoding", "gzip")
+			if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `"small"` {
+				t.Fatalf("\t%s\tTest %d:\tShould not compress a small body : %v %q", failed, testID, w.Header(), w.Body.String())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not compress a small body.", success, testID)
+
+			w = serve("/empty", "Accept-Encoding", "gzip")
+			if w.Code != http.StatusNoContent || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not compress an empty body : %v %v", failed, testID, w.Code, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not compress an empty body.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the client accepts several encodings.", testID)
+		{
+			w := serve("/large", "Accept-Encoding", "gzip, deflate, zstd")
+			if w.Header().Get("Content-Encoding") != "zstd" {
+				t.Fatalf("\t%s\tTest %d:\tShould prefer zstd : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould prefer zstd.", success, testID)
+
+			zr, err := zstd.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the body : %s", failed, testID, err)
+			}
+			defer zr.Close()
+			var got string
+			if err := json.NewDecoder(zr).Decode(&got); err != nil || got != large {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the body : %q %v", failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to decode the body.", success, testID)
+
+			if w := serve("/large", "Accept-Encoding", "zstd;q=0.5, gzip"); w.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("\t%s\tTest %d:\tShould honor the quality of the encodings : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould honor the quality of the encodings.", success, testID)
+
+			if w := serve("/large", "Accept-Encoding", "*, zstd;q=0, gzip;q=0"); w.Header().Get("Content-Encoding") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould not use a refused encoding : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould not use a refused encoding.", success, testID)
+
+			if w := serve("/large", "Accept-Encoding", "gzip", "Accept", "application/xml"); w.Header().Get("Content-Encoding") != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould only compress the listed media types : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould only compress the listed media types.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a small collection is streamed.", testID)
+		{
+			w := serve("/numbers", "Accept-Encoding", "gzip", "Accept", "application/x-ndjson")
+			if w.Header().Get("Content-Encoding") != "gzip" || !w.Flushed {
+				t.Fatalf("\t%s\tTest %d:\tShould compress the flushed body : %v", failed, testID, w.Header())
+			}
+			t.Logf("\t%s\tTest %d:\tShould compress the flushed body.", success, testID)
+
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the body : %s", failed, testID, err)
+			}
+			body, err := io.ReadAll(zr)
+			if err != nil || string(body) != "1\n2\n3\n" {
+				t.Fatalf("\t%s\tTest %d:\tShould write a line per value : %q %v", failed, testID, body, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould write a line per value.", success, testID)
+		}
+	}
+}
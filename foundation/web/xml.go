@@ -0,0 +1,458 @@
+package web
+
+import (
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	xmlNameType         = reflect.TypeOf(xml.Name{})
+)
+
+// fieldError is returned by a codec for a field it can't decode.
+type fieldError struct {
+	field string
+	err   error
+}
+
+// Error implements the error interface.
+func (fe *fieldError) Error() string {
+	return fmt.Sprintf("field %q: %v", fe.field, fe.err)
+}
+
+// jsonField returns the name of a struct field in the json encoding and if
+// it's omitted when empty. False is returned for the fields the json
+// encoding leaves out.
+func jsonField(f reflect.StructField) (name string, omitEmpty bool, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false, false
+	}
+
+	name = f.Name
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, false
+	}
+	if tag != "" {
+		opts := strings.Split(tag, ",")
+		if opts[0] != "" {
+			name = opts[0]
+		}
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+	}
+
+	return name, omitEmpty, true
+}
+
+// xmlField describes how a struct field is encoded as an element.
+type xmlField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// xmlFields returns the fields of a struct in the order they are encoded,
+// with the fields of embedded structs promoted like the json encoding does.
+func xmlFields(rt reflect.Type) []xmlField {
+	var fields []xmlField
+
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.Type == xmlNameType {
+			continue
+		}
+
+		name, omitEmpty, ok := jsonField(f)
+		if !ok {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" && ft.Kind() == reflect.Struct {
+			for _, ef := range xmlFields(ft) {
+				ef.index = append([]int{i}, ef.index...)
+				fields = append(fields, ef)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+
+		fields = append(fields, xmlField{name: name, index: []int{i}, omitEmpty: omitEmpty})
+	}
+
+	return fields
+}
+
+// xmlRoot returns the name of the root element of a value. It is taken from
+// the tag of an XMLName field or else from the type.
+func xmlRoot(rt reflect.Type) xml.Name {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.Slice, reflect.Array:
+		return xml.Name{Local: "list"}
+	case reflect.Struct:
+		if f, ok := rt.FieldByName("XMLName"); ok && f.Type == xmlNameType {
+			if tag := strings.Split(f.Tag.Get("xml"), ",")[0]; tag != "" {
+				if i := strings.LastIndex(tag, " "); i >= 0 {
+					return xml.Name{Space: tag[:i], Local: tag[i+1:]}
+				}
+				return xml.Name{Local: tag}
+			}
+		}
+	}
+
+	if rt.Name() == "" {
+		return xml.Name{Local: "value"}
+	}
+	return xml.Name{Local: rt.Name()}
+}
+
+// =============================================================================
+
+// encodeXML writes the value as an element with the name.
+func encodeXML(enc *xml.Encoder, name xml.Name, v reflect.Value) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	start := xml.StartElement{Name: name}
+
+	// Values with their own text form are written like the json encoding
+	// writes them.
+	if m, ok := implementer(v, textMarshalerType); ok {
+		text, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		return encodeXMLText(enc, start, string(text))
+	}
+	if m, ok := implementer(v, jsonMarshalerType); ok {
+		data, err := m.(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		text := string(data)
+		if s, err := strconv.Unquote(text); err == nil {
+			text = s
+		}
+		return encodeXMLText(enc, start, text)
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, f := range xmlFields(v.Type()) {
+			fv, ok := fieldByIndex(v, f.index)
+			if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			if err := encodeXML(enc, xml.Name{Local: f.name}, fv); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return encodeXMLText(enc, start, base64.StdEncoding.EncodeToString(data))
+		}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeXML(enc, xml.Name{Local: "item"}, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+
+	case reflect.String:
+		return encodeXMLText(enc, start, v.String())
+	case reflect.Bool:
+		return encodeXMLText(enc, start, strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return encodeXMLText(enc, start, strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return encodeXMLText(enc, start, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		return encodeXMLText(enc, start, strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))
+	}
+
+	return ErrUnsupported
+}
+
+// encodeXMLText writes an element holding the text.
+func encodeXMLText(enc *xml.Encoder, start xml.StartElement, text string) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := enc.EncodeToken(xml.CharData(text)); err != nil {
+		return err
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// =============================================================================
+
+// decodeXML reads the element which just started into the value. The path
+// names the field being decoded for the errors.
+func decodeXML(dec *xml.Decoder, v reflect.Value, path string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeXML(dec, v.Elem(), path)
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		text, err := decodeXMLText(dec, path)
+		if err != nil {
+			return err
+		}
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return &fieldError{field: path, err: err}
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := make(map[string][]int)
+		for _, f := range xmlFields(v.Type()) {
+			fields[f.name] = f.index
+		}
+
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				name := join(path, tok.Name.Local)
+				index, ok := fields[tok.Name.Local]
+				if !ok {
+					return &fieldError{field: name, err: errors.New("unknown field")}
+				}
+				if err := decodeXML(dec, allocField(v, index), name); err != nil {
+					return err
+				}
+			case xml.EndElement:
+				return nil
+			}
+		}
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			text, err := decodeXMLText(dec, path)
+			if err != nil {
+				return err
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+			if err != nil {
+				return &fieldError{field: path, err: errors.New("expected base64 data")}
+			}
+			v.SetBytes(data)
+			return nil
+		}
+
+		v.Set(reflect.MakeSlice(v.Type(), 0, 0))
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+
+			switch tok.(type) {
+			case xml.StartElement:
+				item := reflect.New(v.Type().Elem()).Elem()
+				if err := decodeXML(dec, item, path); err != nil {
+					return err
+				}
+				v.Set(reflect.Append(v, item))
+			case xml.EndElement:
+				return nil
+			}
+		}
+
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		text, err := decodeXMLText(dec, path)
+		if err != nil {
+			return err
+		}
+		return setXMLText(v, text, path)
+	}
+
+	return ErrUnsupported
+}
+
+// decodeXMLText reads the text of the element which started, up to its end.
+func decodeXMLText(dec *xml.Decoder, path string) (string, error) {
+	var text strings.Builder
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", err
+		}
+
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.StartElement:
+			return "", &fieldError{field: path, err: errors.New("expected text but got an element")}
+		case xml.EndElement:
+			return text.String(), nil
+		}
+	}
+}
+
+// setXMLText sets a value of a basic kind from the text of an element.
+func setXMLText(v reflect.Value, text string, path string) error {
+	if v.Kind() == reflect.String {
+		v.SetString(text)
+		return nil
+	}
+
+	var err error
+	text = strings.TrimSpace(text)
+	switch v.Kind() {
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(text); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(text, 10, v.Type().Bits()); err == nil {
+			v.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(text, 10, v.Type().Bits()); err == nil {
+			v.SetUint(n)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(text, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	}
+
+	if err != nil {
+		return &fieldError{field: path, err: fmt.Errorf("expected %s but got %q", v.Type(), text)}
+	}
+	return nil
+}
+
+// =============================================================================
+
+// implementer returns the value as the interface, or a pointer to it when
+// only the pointer implements the interface. A value which can't be
+// addressed is copied to take its address.
+func implementer(v reflect.Value, it reflect.Type) (interface{}, bool) {
+	if v.Type().Implements(it) {
+		return v.Interface(), true
+	}
+	if !reflect.PtrTo(v.Type()).Implements(it) {
+		return nil, false
+	}
+	if v.CanAddr() {
+		return v.Addr().Interface(), true
+	}
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p.Interface(), true
+}
+
+// fieldByIndex returns the field of a struct, false when it's promoted from
+// an embedded pointer which is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}, false
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// allocField returns the field of a struct, allocating the embedded
+// pointers it's promoted from.
+func allocField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// isEmptyValue reports if the value is omitted by the omitempty option of
+// the json encoding.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// join appends the name of a field to the path of its parent.
+func join(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -13,7 +13,10 @@ require (
 	github.com/google/go-cmp v0.5.6
 	github.com/google/uuid v1.3.0
 	github.com/jmoiron/sqlx v1.3.4
+	github.com/klauspost/compress v1.15.0
 	github.com/lib/pq v1.10.4
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+	github.com/youmark/pkcs8 v0.0.0-20201027041543-1326539a0a0a
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.28.0
 	go.opentelemetry.io/otel v1.3.0
 	go.opentelemetry.io/otel/exporters/zipkin v1.3.0
@@ -30,6 +33,7 @@ require (
 	github.com/go-logr/stdr v1.2.0 // indirect
 	github.com/leodido/go-urn v1.2.1 // indirect
 	github.com/openzipkin/zipkin-go v0.3.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	go.opentelemetry.io/otel/internal/metric v0.26.0 // indirect
 	go.opentelemetry.io/otel/metric v0.26.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect